@@ -0,0 +1,230 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+)
+
+// AssetPolicy sets how WithFetchAssets fetches the assets of the pages
+type AssetPolicy int
+
+const (
+	// DownloadAssets fetches the assets with GET and parses them, fetching
+	// the assets they reference too, such as the images and fonts from
+	// stylesheets. Bodies are kept with WithKeepBody.
+	DownloadAssets AssetPolicy = iota + 1
+
+	// CheckAssets requests the assets with HEAD, falling back to GET when
+	// the server does not support HEAD, without reading their body
+	CheckAssets
+)
+
+// assetFetcher keeps track of the assets fetched, so they are fetched once
+// even when referenced from many pages
+type assetFetcher struct {
+	policy AssetPolicy
+
+	mut     sync.Mutex
+	results map[string]*assetResult
+}
+
+// assetResult is the outcome of fetching an asset, available once done is
+// closed
+type assetResult struct {
+	done       chan struct{}
+	statusCode int
+	size       int64
+	err        error
+}
+
+func newAssetFetcher(policy AssetPolicy) *assetFetcher {
+	if policy == 0 {
+		return nil
+	}
+	return &assetFetcher{
+		policy:  policy,
+		results: make(map[string]*assetResult),
+	}
+}
+
+// claim returns the result for the URL, and whether the caller has to fetch
+// it because nobody else did
+func (f *assetFetcher) claim(uri string) (*assetResult, bool) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if result, ok := f.results[uri]; ok {
+		return result, false
+	}
+	result := &assetResult{done: make(chan struct{})}
+	f.results[uri] = result
+	return result, true
+}
+
+// record fills the asset with the result
+func (r *assetResult) record(asset *Asset) {
+	asset.StatusCode = r.statusCode
+	if r.size > 0 {
+		asset.Size = r.size
+	}
+	if r.err != nil {
+		asset.Error = r.err.Error()
+	}
+}
+
+// fetchAssets fetches the assets of the response that were not fetched yet
+// and records the result of all of them in res.Assets. When wait is set it
+// waits for the assets being fetched by other goroutines, while assets of
+// assets only record the results available to avoid waiting on cycles. It
+// only returns an error when the crawl must stop.
+func (w *Worker) fetchAssets(ctx context.Context, res *Response, wait bool) error {
+	for i := range res.Assets {
+		asset := &res.Assets[i]
+		req, err := nextAsset(res, asset.URL)
+		if err != nil {
+			continue
+		}
+		result, fetch := w.assets.claim(req.URL.String())
+		if fetch {
+			err := w.fetchAsset(ctx, req, result)
+			close(result.done)
+			if err != nil {
+				return err
+			}
+		} else if wait {
+			select {
+			case <-result.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		select {
+		case <-result.done:
+			result.record(asset)
+		default:
+		}
+	}
+	return nil
+}
+
+// fetchAsset fetches the asset following its redirects, reporting every
+// response to the CrawlFunc and keeping the last one in the result. Assets
+// not allowed by the checks are skipped. It only returns an error when the
+// crawl must stop.
+func (w *Worker) fetchAsset(ctx context.Context, req *Request, result *assetResult) error {
+	if !w.assetCheck.CheckFetch(req) {
+		return nil
+	}
+	res, err := w.requestAsset(ctx, req)
+	if err := ctx.Err(); err != nil {
+		releaseBody(res)
+		result.err = err
+		return err
+	}
+	if err == nil && res.RedirectTo != "" {
+		err = checkRedirect(req, res, w.maxRedirs)
+	}
+	var next *Request
+	if err == nil && res.RedirectTo != "" {
+		next, _ = nextRequest(res, res.RedirectTo, true)
+	}
+	if res != nil {
+		result.statusCode = res.StatusCode
+		result.size = res.ContentLength
+	}
+	result.err = err
+	if err == nil && next == nil && w.assets.policy == DownloadAssets {
+		if err := w.fetchAssets(ctx, res, false); err != nil {
+			releaseBody(res)
+			return err
+		}
+	}
+	fnErr := w.fn(req.URL.String(), res, err)
+	releaseBody(res)
+	if fnErr != nil && fnErr != ErrSkipURL {
+		return fnErr
+	}
+	if next == nil {
+		return nil
+	}
+	// redirect targets are fetched once too. Pending targets are not waited
+	// for as they might be redirecting back.
+	target, fetch := w.assets.claim(next.URL.String())
+	if fetch {
+		err := w.fetchAsset(ctx, next, target)
+		close(target.done)
+		if err != nil {
+			return err
+		}
+	}
+	select {
+	case <-target.done:
+		result.statusCode, result.size, result.err = target.statusCode, target.size, target.err
+	default:
+	}
+	return nil
+}
+
+// requestAsset requests the asset following the policy
+func (w *Worker) requestAsset(ctx context.Context, req *Request) (*Response, error) {
+	if err := w.prepare(ctx, req); err != nil {
+		return nil, err
+	}
+	if w.assets.policy == CheckAssets {
+		return checkAsset(ctx, w.client, req, w.fetch.userAgent)
+	}
+	res, err := fetch(ctx, w.client, req, w.fetch)
+	if err == nil {
+		err = w.extract(req, res)
+	}
+	return res, err
+}
+
+// checkAsset requests the URL with HEAD, falling back to GET when the server
+// does not allow HEAD, without reading the body
+func checkAsset(ctx context.Context, c *http.Client, req *Request, userAgent string) (*Response, error) {
+	trace := newTimingTrace()
+	do := func(method string) (*http.Response, error) {
+		httpReq, err := http.NewRequest(method, req.URL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if userAgent != "" {
+			httpReq.Header.Set("User-Agent", userAgent)
+		}
+		return c.Do(httpReq.WithContext(httptrace.WithClientTrace(ctx, trace.clientTrace())))
+	}
+	httpRes, err := do(http.MethodHead)
+	if err == nil && (httpRes.StatusCode == http.StatusMethodNotAllowed || httpRes.StatusCode == http.StatusNotImplemented) {
+		httpRes.Body.Close()
+		httpRes, err = do(http.MethodGet)
+	}
+	if err != nil {
+		return nil, newNetworkError(req, err)
+	}
+	httpRes.Body.Close()
+	res, err := newResponse(req, httpRes)
+	if res != nil {
+		res.Timing = trace.done()
+	}
+	return res, err
+}
+
+// nextAsset builds the request to fetch an asset of the response, which is
+// fetched at the same depth as the response
+func nextAsset(res *Response, href string) (*Request, error) {
+	req, err := NewRequest(href)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, ErrSkipURL
+	}
+	req.depth = res.request.depth
+	req.page = res.request.page
+	if req.page == nil {
+		req.page = res.request.URL
+	}
+	return req, nil
+}
@@ -0,0 +1,259 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newAssetsServer(t *testing.T) (*httptest.Server, *sync.Map) {
+	pages := map[string]string{
+		"/":           `<a href="/other">other</a><img src="/logo.png"><link rel="stylesheet" href="/style.css"><iframe src="/frame.html"></iframe><img src="data:image/gif;base64,R0lGODlhAQABAAAAACw="><script src="/missing.js"></script><img src="/moved.png">`,
+		"/other":      `<img src="/logo.png"><a href="/deeper">deeper</a>`,
+		"/frame.html": `<a href="/from-frame">not followed</a><img src="/frame.png">`,
+		"/style.css":  `body { background: url(bg.png) }`,
+	}
+	var methods sync.Map
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods.Store(r.Method+" "+r.URL.Path, true)
+		switch r.URL.Path {
+		case "/missing.js":
+			http.NotFound(w, r)
+			return
+		case "/moved.png":
+			http.Redirect(w, r, "/logo.png", http.StatusMovedPermanently)
+			return
+		case "/frame.png":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+		}
+		switch path.Ext(r.URL.Path) {
+		case ".css":
+			w.Header().Set("Content-Type", "text/css")
+		case ".png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("Content-Length", "3")
+			w.Write([]byte("png"))
+			return
+		default:
+			w.Header().Set("Content-Type", "text/html")
+		}
+		w.Write([]byte(pages[r.URL.Path]))
+	}))
+	return s, &methods
+}
+
+func TestFetchAssetsDownload(t *testing.T) {
+	r := require.New(t)
+	s, methods := newAssetsServer(t)
+	defer s.Close()
+
+	var assetPages sync.Map
+	c, err := New(WithFetchAssets(DownloadAssets), WithMaxDepth(1), WithCheckFetch(func(req *Request) bool {
+		if req.IsAsset() {
+			assetPages.Store(strings.TrimPrefix(req.URL.String(), s.URL), req.Page().String())
+		}
+		return true
+	}))
+	r.NoError(err)
+
+	var (
+		fetched, pages, assets []string
+		home                   *Response
+	)
+	err = c.Crawl(s.URL+"/", func(url string, res *Response, err error) error {
+		u := strings.TrimPrefix(url, s.URL)
+		fetched = append(fetched, u)
+		if res != nil && res.Asset {
+			assets = append(assets, u)
+		} else {
+			pages = append(pages, u)
+		}
+		if u == "/" {
+			home = res
+		}
+		return nil
+	})
+	r.NoError(err)
+
+	// links from the iframe and from deeper pages are not followed, and
+	// the logo is fetched once
+	r.Equal([]string{"/", "/other"}, pages)
+	r.Equal(Stats{Fetched: 2}, c.Stats())
+	r.ElementsMatch([]string{
+		"/logo.png",
+		"/style.css",
+		"/bg.png",
+		"/frame.html",
+		"/frame.png",
+		"/missing.js",
+		"/moved.png",
+	}, assets)
+	_, ok := methods.Load("HEAD /logo.png")
+	r.False(ok)
+
+	// the assets are fetched before the page referencing them is reported
+	index := make(map[string]int)
+	for i, u := range fetched {
+		index[u] = i
+	}
+	for _, asset := range []string{"/logo.png", "/style.css", "/bg.png", "/frame.html", "/moved.png"} {
+		r.True(index[asset] < index["/"], asset)
+	}
+
+	// assets of assets belong to the page referencing the first asset
+	for _, asset := range []string{"/style.css", "/bg.png", "/frame.png"} {
+		page, ok := assetPages.Load(asset)
+		r.True(ok, asset)
+		r.Equal(s.URL+"/", page, asset)
+	}
+
+	r.Len(home.Assets, 6)
+	for _, asset := range home.Assets {
+		switch strings.TrimPrefix(asset.URL, s.URL) {
+		case "/logo.png", "/moved.png":
+			r.Equal(http.StatusOK, asset.StatusCode, asset.URL)
+			r.Equal(int64(3), asset.Size, asset.URL)
+		case "/missing.js":
+			r.Equal(http.StatusNotFound, asset.StatusCode)
+			r.Equal("404 Not Found for "+s.URL+"/missing.js", asset.Error)
+		case "/style.css", "/frame.html":
+			r.Equal(http.StatusOK, asset.StatusCode, asset.URL)
+		default:
+			r.Zero(asset.StatusCode, asset.URL)
+		}
+	}
+}
+
+func TestFetchAssetsCheck(t *testing.T) {
+	r := require.New(t)
+	s, methods := newAssetsServer(t)
+	defer s.Close()
+
+	c, err := New(WithFetchAssets(CheckAssets), WithMaxDepth(1))
+	r.NoError(err)
+
+	var (
+		assets []string
+		home   *Response
+	)
+	err = c.Crawl(s.URL+"/", func(url string, res *Response, err error) error {
+		u := strings.TrimPrefix(url, s.URL)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
+			r.True(httpErr.Request.IsAsset())
+		}
+		if res != nil && res.Asset {
+			assets = append(assets, u)
+			r.Empty(res.Links)
+			r.Empty(res.Assets)
+		}
+		if u == "/" {
+			home = res
+		}
+		return nil
+	})
+	r.NoError(err)
+
+	// stylesheets are not parsed when checking assets
+	r.ElementsMatch([]string{
+		"/logo.png",
+		"/style.css",
+		"/frame.html",
+		"/missing.js",
+		"/moved.png",
+	}, assets)
+	for _, req := range []string{"HEAD /logo.png", "HEAD /style.css", "HEAD /missing.js"} {
+		_, ok := methods.Load(req)
+		r.True(ok, req)
+	}
+	_, ok := methods.Load("GET /logo.png")
+	r.False(ok)
+
+	var missing Asset
+	for _, asset := range home.Assets {
+		if strings.HasSuffix(asset.URL, "/missing.js") {
+			missing = asset
+		}
+	}
+	r.Equal(http.StatusNotFound, missing.StatusCode)
+}
+
+func TestFetchAssetsCheckFetch(t *testing.T) {
+	r := require.New(t)
+	var external int32
+	ext := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&external, 1)
+	}))
+	defer ext.Close()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			w.Write([]byte("png"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<img src="/logo.png"><img src="/ignored.png"><img src="` + ext.URL + `/external.png">`))
+	}))
+	defer s.Close()
+
+	c, err := New(
+		WithFetchAssets(CheckAssets),
+		WithAllowedHosts(s.Listener.Addr().String()),
+		WithCheckFetch(func(req *Request) bool {
+			return req.URL.Path != "/ignored.png"
+		}),
+	)
+	r.NoError(err)
+
+	var (
+		assets []string
+		home   *Response
+	)
+	err = c.Crawl(s.URL+"/", func(url string, res *Response, err error) error {
+		r.NoError(err)
+		if res.Asset {
+			assets = append(assets, strings.TrimPrefix(url, s.URL))
+		} else {
+			home = res
+		}
+		return nil
+	})
+	r.NoError(err)
+
+	r.Equal([]string{"/logo.png"}, assets)
+	r.Zero(atomic.LoadInt32(&external))
+	r.Len(home.Assets, 3)
+	r.Equal(http.StatusOK, home.Assets[0].StatusCode)
+	r.Zero(home.Assets[1].StatusCode)
+	r.Zero(home.Assets[2].StatusCode)
+}
+
+func TestCheckAssetFallsBackToGet(t *testing.T) {
+	r := require.New(t)
+	s, methods := newAssetsServer(t)
+	defer s.Close()
+
+	req, err := NewRequest(s.URL + "/frame.png")
+	r.NoError(err)
+	res, err := checkAsset(context.Background(), &http.Client{}, req, "")
+	r.NoError(err)
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.Equal(int64(3), res.ContentLength)
+	_, ok := methods.Load("GET /frame.png")
+	r.True(ok)
+}
+
+func TestWithFetchAssetsInvalidPolicy(t *testing.T) {
+	_, err := New(WithFetchAssets(AssetPolicy(0)))
+	require.Error(t, err)
+}
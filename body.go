@@ -0,0 +1,124 @@
+package crawler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// keepBodyMemory is the size up to which kept bodies are held in memory.
+// Bigger bodies are written to a temporary file.
+const keepBodyMemory = 1 << 20
+
+// ErrBodyReleased is returned when reading a Body after the CrawlFunc for
+// its response returned
+var ErrBodyReleased = errors.New("body no longer available")
+
+// Body is the body of a response kept with WithKeepBody, as returned by the
+// HTTP transport. Small bodies are kept in memory, while bigger ones are
+// written to a temporary file. The body is released once the CrawlFunc
+// returns.
+type Body struct {
+	size     int64
+	data     []byte
+	path     string
+	released bool
+}
+
+// Size returns the length of the body in bytes
+func (b *Body) Size() int64 {
+	return b.size
+}
+
+// Open returns a reader for the body. It can be called several times.
+func (b *Body) Open() (io.ReadCloser, error) {
+	if b.released {
+		return nil, ErrBodyReleased
+	}
+	if b.path == "" {
+		return ioutil.NopCloser(bytes.NewReader(b.data)), nil
+	}
+	return os.Open(b.path)
+}
+
+// Bytes returns the whole body
+func (b *Body) Bytes() ([]byte, error) {
+	if b.released {
+		return nil, ErrBodyReleased
+	}
+	if b.path == "" {
+		return b.data, nil
+	}
+	return ioutil.ReadFile(b.path)
+}
+
+// release frees the body, removing its temporary file if any
+func (b *Body) release() error {
+	b.released = true
+	b.data = nil
+	if b.path == "" {
+		return nil
+	}
+	return os.Remove(b.path)
+}
+
+// releaseBody releases the body kept for the response, if any
+func releaseBody(res *Response) {
+	if res != nil && res.Body != nil {
+		res.Body.release()
+	}
+}
+
+// bodyWriter keeps the data written in memory, moving it to a temporary file
+// once it grows over keepBodyMemory
+type bodyWriter struct {
+	buf  bytes.Buffer
+	file *os.File
+	size int64
+}
+
+func (w *bodyWriter) Write(p []byte) (int, error) {
+	if w.file == nil && w.buf.Len()+len(p) > keepBodyMemory {
+		f, err := ioutil.TempFile("", "crawler-body-")
+		if err != nil {
+			return 0, err
+		}
+		w.file = f
+		if _, err := w.buf.WriteTo(f); err != nil {
+			return 0, err
+		}
+	}
+	var (
+		n   int
+		err error
+	)
+	if w.file != nil {
+		n, err = w.file.Write(p)
+	} else {
+		n, err = w.buf.Write(p)
+	}
+	w.size += int64(n)
+	return n, err
+}
+
+// body returns the Body with the data written
+func (w *bodyWriter) body() (*Body, error) {
+	if w.file == nil {
+		return &Body{size: w.size, data: w.buf.Bytes()}, nil
+	}
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.file.Name())
+		return nil, err
+	}
+	return &Body{size: w.size, path: w.file.Name()}, nil
+}
+
+// discard removes the temporary file, if any
+func (w *bodyWriter) discard() {
+	if w.file != nil {
+		w.file.Close()
+		os.Remove(w.file.Name())
+	}
+}
@@ -0,0 +1,168 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyWriterSpillsToDisk(t *testing.T) {
+	r := require.New(t)
+
+	w := &bodyWriter{}
+	small := bytes.Repeat([]byte("a"), keepBodyMemory)
+	_, err := w.Write(small)
+	r.NoError(err)
+	r.Nil(w.file)
+	_, err = w.Write([]byte("b"))
+	r.NoError(err)
+	r.NotNil(w.file)
+
+	body, err := w.body()
+	r.NoError(err)
+	r.Equal(int64(keepBodyMemory+1), body.Size())
+	r.NotEmpty(body.path)
+
+	b, err := body.Bytes()
+	r.NoError(err)
+	r.Equal(append(small, 'b'), b)
+
+	r.NoError(body.release())
+	_, err = os.Stat(body.path)
+	r.True(os.IsNotExist(err))
+	_, err = body.Open()
+	r.Equal(ErrBodyReleased, err)
+}
+
+func TestWithMaxBodySize(t *testing.T) {
+	r := require.New(t)
+
+	page := "<html><body><a href=\"/first\">first</a>" + strings.Repeat(" ", 1024) + "<a href=\"/second\">second</a></body></html>"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			// no Content-Length so the size is only known after reading
+			w.(http.Flusher).Flush()
+			io.WriteString(w, page)
+		}
+	}))
+	defer s.Close()
+
+	c, err := New(WithMaxBodySize(512), WithKeepBody())
+	r.NoError(err)
+
+	var res *Response
+	err = c.Crawl(s.URL, func(url string, r *Response, err error) error {
+		if url == s.URL+"/" {
+			res = r
+		}
+		return ErrSkipURL
+	})
+	r.NoError(err)
+	r.True(res.Truncated)
+	r.Equal([]Link{{URL: s.URL + "/first", Text: "first", Line: 1, Column: 13}}, res.Links)
+	r.Equal(int64(512), res.ContentLength)
+	r.Equal(int64(512), res.Body.Size())
+
+	_, err = New(WithMaxBodySize(0))
+	r.Error(err)
+}
+
+func TestWithKeepBody(t *testing.T) {
+	r := require.New(t)
+
+	s := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer s.Close()
+
+	c, err := New(WithKeepBody())
+	r.NoError(err)
+
+	expected, err := ioutil.ReadFile("testdata/depth-one.html")
+	r.NoError(err)
+
+	var (
+		kept *Body
+		hash [sha256.Size]byte
+	)
+	err = c.Crawl(s.URL+"/depth-one.html", func(url string, res *Response, err error) error {
+		r.NoError(err)
+		kept = res.Body
+		f, err := res.Body.Open()
+		r.NoError(err)
+		defer f.Close()
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		r.NoError(err)
+		copy(hash[:], h.Sum(nil))
+		r.False(res.Truncated)
+		return ErrSkipURL
+	})
+	r.NoError(err)
+	r.Equal(sha256.Sum256(expected), hash)
+
+	// bodies are released after the CrawlFunc returns
+	_, err = kept.Bytes()
+	r.Equal(ErrBodyReleased, err)
+}
+
+// cancelAtEOF cancels the crawl once the body has been read
+type cancelAtEOF struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (r cancelAtEOF) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		r.cancel()
+	}
+	return n, err
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWithKeepBodyReleasedOnCancel(t *testing.T) {
+	r := require.New(t)
+	tmp, err := ioutil.TempDir("", "crawler-tmp")
+	r.NoError(err)
+	defer os.RemoveAll(tmp)
+	t.Setenv("TMPDIR", tmp)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("a"), 2*keepBodyMemory))
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := New(WithKeepBody(), WithHTTPTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := http.DefaultTransport.RoundTrip(req)
+		if err == nil {
+			res.Body = cancelAtEOF{ReadCloser: res.Body, cancel: cancel}
+		}
+		return res, err
+	})))
+	r.NoError(err)
+
+	err = c.CrawlContext(ctx, s.URL+"/", func(url string, res *Response, err error) error {
+		return nil
+	})
+	r.Equal(context.Canceled, err)
+
+	files, err := ioutil.ReadDir(tmp)
+	r.NoError(err)
+	r.Empty(files)
+}
@@ -0,0 +1,244 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	checkpointQueueFile   = "queue.log"
+	checkpointVisitedFile = "visited.log"
+	checkpointStateFile   = "state.json"
+
+	defaultCheckpointInterval = 30 * time.Second
+)
+
+// Stats holds the counters of a crawl
+type Stats struct {
+	// Fetched is the amount of pages fetched successfully. Assets fetched
+	// with WithFetchAssets are not counted
+	Fetched int `json:"fetched"`
+
+	// Failed is the amount of pages that could not be fetched
+	Failed int `json:"failed"`
+}
+
+type checkpointState struct {
+	StartURL  string    `json:"start_url"`
+	Stats     Stats     `json:"stats"`
+	Finished  bool      `json:"finished"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// checkpoint keeps the state of a crawl in a directory so it can be resumed.
+// The queue and the visited URLs are appended to logs as the crawl goes,
+// while the counters are snapshotted periodically.
+type checkpoint struct {
+	dir     string
+	queue   *FileQueue
+	visited *visitedSet
+	state   checkpointState
+}
+
+// createCheckpoint starts a new checkpoint in dir, discarding any previous one
+func createCheckpoint(ctx context.Context, dir, startURL string) (*checkpoint, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{checkpointQueueFile, checkpointVisitedFile, checkpointStateFile} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	cp, err := openCheckpoint(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	cp.state.StartURL = startURL
+	return cp, nil
+}
+
+// HasCheckpoint returns whether dir has the checkpoint of a crawl that did not
+// finish, which can be continued with Simple.Resume
+func HasCheckpoint(dir string) bool {
+	state, err := readCheckpointState(dir)
+	return err == nil && !state.Finished
+}
+
+// loadCheckpoint opens an existing checkpoint from dir
+func loadCheckpoint(ctx context.Context, dir string) (*checkpoint, error) {
+	state, err := readCheckpointState(dir)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := openCheckpoint(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	cp.state = state
+	return cp, nil
+}
+
+func readCheckpointState(dir string) (checkpointState, error) {
+	var state checkpointState
+	b, err := ioutil.ReadFile(filepath.Join(dir, checkpointStateFile))
+	if os.IsNotExist(err) {
+		return state, errors.Errorf("no crawl checkpoint found in %s", dir)
+	} else if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return state, errors.Wrapf(err, "reading checkpoint from %s", dir)
+	}
+	return state, nil
+}
+
+func openCheckpoint(ctx context.Context, dir string) (*checkpoint, error) {
+	q, err := NewFileQueue(ctx, filepath.Join(dir, checkpointQueueFile))
+	if err != nil {
+		return nil, err
+	}
+	// requests interrupted in the previous run must be fetched again
+	v, err := openVisitedSet(filepath.Join(dir, checkpointVisitedFile), q.requeued)
+	if err != nil {
+		q.Close()
+		return nil, err
+	}
+	return &checkpoint{
+		dir:     dir,
+		queue:   q,
+		visited: v,
+	}, nil
+}
+
+// save snapshots the crawl counters
+func (cp *checkpoint) save(stats Stats, finished bool) error {
+	if err := cp.visited.sync(); err != nil {
+		return err
+	}
+	cp.state.Stats = stats
+	cp.state.Finished = finished
+	cp.state.UpdatedAt = time.Now()
+	b, err := json.Marshal(cp.state)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(cp.dir, checkpointStateFile)
+	if err := ioutil.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (cp *checkpoint) Close() error {
+	err := cp.queue.Close()
+	if verr := cp.visited.Close(); err == nil {
+		err = verr
+	}
+	return err
+}
+
+// visitedSet tracks the URLs requested during a crawl, appending them to a
+// log so they are remembered when the crawl is resumed
+type visitedSet struct {
+	mut  sync.Mutex
+	urls map[string]struct{}
+	f    *os.File
+	w    *bufio.Writer
+	err  error
+}
+
+// openVisitedSet loads the visited URLs from path leaving out the given ones
+func openVisitedSet(path string, forget []string) (*visitedSet, error) {
+	v := &visitedSet{urls: make(map[string]struct{})}
+	if f, err := os.Open(path); err == nil {
+		s := bufio.NewScanner(f)
+		s.Buffer(nil, 1<<20)
+		for s.Scan() {
+			v.urls[s.Text()] = struct{}{}
+		}
+		f.Close()
+		if err := s.Err(); err != nil {
+			return nil, errors.Wrapf(err, "reading visited URLs from %s", path)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, u := range forget {
+		delete(v.urls, u)
+	}
+
+	// rewrite the log without the forgotten URLs
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	for u := range v.urls {
+		w.WriteString(u)
+		w.WriteByte('\n')
+	}
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	v.f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	v.w = bufio.NewWriter(v.f)
+	return v, nil
+}
+
+// check is a CheckFetchFunc allowing each URL only once
+func (v *visitedSet) check(req *Request) bool {
+	v.mut.Lock()
+	defer v.mut.Unlock()
+	u := req.URL.String()
+	if _, ok := v.urls[u]; ok {
+		return false
+	}
+	v.urls[u] = struct{}{}
+	if v.err == nil {
+		v.w.WriteString(u)
+		v.w.WriteByte('\n')
+		v.err = v.w.Flush()
+	}
+	return true
+}
+
+func (v *visitedSet) sync() error {
+	v.mut.Lock()
+	defer v.mut.Unlock()
+	if v.err != nil {
+		return v.err
+	}
+	return v.f.Sync()
+}
+
+func (v *visitedSet) Close() error {
+	v.mut.Lock()
+	defer v.mut.Unlock()
+	err := v.w.Flush()
+	if cerr := v.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrawlCheckpointResume(t *testing.T) {
+	r := require.New(t)
+
+	s := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "crawler-checkpoint")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	c, err := New(WithCheckpoint(dir, time.Millisecond))
+	r.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var urls []string
+	err = c.CrawlContext(ctx, s.URL+"/start-cycle.html", func(url string, res *Response, err error) error {
+		urls = append(urls, url)
+		if strings.HasSuffix(url, "/intermediate-cycle.html") {
+			cancel()
+		}
+		return err
+	})
+	r.Equal(context.Canceled, err)
+	r.Equal([]string{
+		s.URL + "/start-cycle.html",
+		s.URL + "/intermediate-cycle.html",
+	}, urls)
+	r.Equal(Stats{Fetched: 2}, c.Stats())
+	r.True(HasCheckpoint(dir))
+
+	c, err = New()
+	r.NoError(err)
+
+	urls = nil
+	err = c.Resume(dir, func(url string, res *Response, err error) error {
+		urls = append(urls, url)
+		return err
+	})
+	r.NoError(err)
+
+	// the page in flight when the crawl was cancelled is fetched again
+	r.Equal([]string{
+		s.URL + "/intermediate-cycle.html",
+		s.URL + "/loop-cycle.html",
+	}, urls)
+	r.Equal(Stats{Fetched: 4}, c.Stats())
+	r.False(HasCheckpoint(dir))
+
+	// resuming a finished crawl has nothing left to do
+	urls = nil
+	r.NoError(c.Resume(dir, func(url string, res *Response, err error) error {
+		urls = append(urls, url)
+		return err
+	}))
+	r.Empty(urls)
+}
+
+func TestResumeWithoutCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-checkpoint")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.False(t, HasCheckpoint(dir))
+
+	c, err := New()
+	require.NoError(t, err)
+
+	err = c.Resume(dir, func(url string, res *Response, err error) error {
+		return err
+	})
+	require.Error(t, err)
+}
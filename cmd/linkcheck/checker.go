@@ -0,0 +1,222 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/ernesto-jimenez/crawler"
+)
+
+// maxRedirects is the amount of redirects followed when resolving the final
+// target of a link
+const maxRedirects = 20
+
+// Reference is a link or asset pointing to a target
+type Reference struct {
+	// Page is the URL of the page with the link
+	Page string `json:"page"`
+
+	// Link is the URL in the page when it is not the target itself, because
+	// it redirected to the target
+	Link string `json:"link,omitempty"`
+
+	// Text is the anchor text of the link
+	Text string `json:"text,omitempty"`
+
+	// Tag is the tag referencing assets. e.g: img
+	Tag string `json:"tag,omitempty"`
+
+	// Line and Column are where the link is in the page, when known
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// Target is a URL checked during the crawl
+type Target struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	References []Reference `json:"references,omitempty"`
+}
+
+// Report is the outcome of checking the links of a site
+type Report struct {
+	StartURL string `json:"start_url"`
+
+	// Checked is the amount of URLs checked
+	Checked int `json:"checked"`
+
+	// Broken are the URLs that could not be fetched, along with the pages
+	// referencing them
+	Broken []Target `json:"broken"`
+
+	// Targets are all the URLs checked
+	Targets []Target `json:"-"`
+}
+
+// checker collects the results of the crawl
+type checker struct {
+	internal map[string]bool
+	ignore   []*regexp.Regexp
+
+	mut       sync.Mutex
+	results   map[string]Target
+	redirects map[string]string
+	refs      map[string][]Reference
+}
+
+func newChecker(internalHosts []string, ignore []*regexp.Regexp) *checker {
+	internal := make(map[string]bool, len(internalHosts))
+	for _, host := range internalHosts {
+		internal[host] = true
+	}
+	return &checker{
+		internal:  internal,
+		ignore:    ignore,
+		results:   make(map[string]Target),
+		redirects: make(map[string]string),
+		refs:      make(map[string][]Reference),
+	}
+}
+
+// checkFetch skips the URLs matching the ignore patterns and the assets of
+// external pages, whose links are not checked either
+func (c *checker) checkFetch(req *crawler.Request) bool {
+	if page := req.Page(); page != nil && !c.internal[page.Host] {
+		return false
+	}
+	return !c.ignored(req.URL.String())
+}
+
+func (c *checker) ignored(uri string) bool {
+	for _, re := range c.ignore {
+		if re.MatchString(uri) {
+			return true
+		}
+	}
+	return false
+}
+
+// crawl records the result of each URL and the links of internal pages.
+// External pages are checked without following their links.
+func (c *checker) crawl(uri string, res *crawler.Response, err error) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	target := Target{URL: uri}
+	if res != nil {
+		target.StatusCode = res.StatusCode
+	}
+	if err != nil {
+		target.Error = err.Error()
+		c.results[uri] = target
+		return nil
+	}
+	c.results[uri] = target
+	if res.RedirectTo != "" {
+		if next, err := normalize(res.RedirectTo); err == nil {
+			c.redirects[uri] = next
+		}
+		return nil
+	}
+	if res.Asset {
+		return nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil || !c.internal[u.Host] {
+		return crawler.ErrSkipURL
+	}
+	for _, link := range res.Links {
+		c.addRef(link.URL, Reference{Page: uri, Text: link.Text, Line: link.Line, Column: link.Column})
+	}
+	for _, asset := range res.Assets {
+		c.addRef(asset.URL, Reference{Page: uri, Tag: asset.Tag})
+	}
+	return nil
+}
+
+func (c *checker) addRef(link string, ref Reference) {
+	target, err := normalize(link)
+	if err != nil || c.ignored(target) {
+		return
+	}
+	ref.Link = target
+	c.refs[target] = append(c.refs[target], ref)
+}
+
+// report aggregates the failures by the URL that failed, following the
+// redirects from the links to it
+func (c *checker) report(startURL string) *Report {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	targets := make(map[string]*Target)
+	for uri, result := range c.results {
+		if _, ok := c.redirects[uri]; ok {
+			continue
+		}
+		result := result
+		targets[uri] = &result
+	}
+	for link, refs := range c.refs {
+		target, ok := targets[c.resolve(link)]
+		if !ok {
+			// not checked because of the max depth or because the redirects
+			// did not end
+			continue
+		}
+		for _, ref := range refs {
+			if ref.Link == target.URL {
+				ref.Link = ""
+			}
+			target.References = append(target.References, ref)
+		}
+	}
+
+	report := &Report{StartURL: startURL, Broken: []Target{}}
+	for _, target := range targets {
+		sort.Slice(target.References, func(i, j int) bool {
+			a, b := target.References[i], target.References[j]
+			if a.Page != b.Page {
+				return a.Page < b.Page
+			}
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			return a.Column < b.Column
+		})
+		report.Targets = append(report.Targets, *target)
+		// failures not referenced from the pages checked are not broken
+		// links, except for the start URL
+		if target.Error != "" && (len(target.References) > 0 || target.URL == startURL) {
+			report.Broken = append(report.Broken, *target)
+		}
+	}
+	sort.Slice(report.Targets, func(i, j int) bool { return report.Targets[i].URL < report.Targets[j].URL })
+	sort.Slice(report.Broken, func(i, j int) bool { return report.Broken[i].URL < report.Broken[j].URL })
+	report.Checked = len(report.Targets)
+	return report
+}
+
+// resolve follows the redirects recorded from the URL
+func (c *checker) resolve(uri string) string {
+	for i := 0; i < maxRedirects; i++ {
+		next, ok := c.redirects[uri]
+		if !ok {
+			return uri
+		}
+		uri = next
+	}
+	return uri
+}
+
+// normalize returns the URL as requested by the crawler
+func normalize(uri string) (string, error) {
+	req, err := crawler.NewRequest(uri)
+	if err != nil {
+		return "", err
+	}
+	return req.URL.String(), nil
+}
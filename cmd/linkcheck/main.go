@@ -0,0 +1,172 @@
+// Command linkcheck crawls a site reporting its broken links.
+//
+// Links to the hosts of the site are crawled fully, while links to other
+// hosts are checked once without following their links. Broken links are
+// grouped by the URL that failed along with every page linking to it, and
+// reported as text, JSON or JUnit XML:
+//
+//	linkcheck -format junit -output links.xml -ignore '^https://twitter\.com/' https://example.com/
+//
+// It exits with 1 when broken links are found and with 2 when the site could
+// not be crawled.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ernesto-jimenez/crawler"
+)
+
+const (
+	exitOK     = 0
+	exitBroken = 1
+	exitError  = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	var (
+		format        string
+		outputFile    string
+		internalHosts string
+		maxDepth      int
+		concurrency   int
+		timeout       time.Duration
+		checkAssets   bool
+		verbose       bool
+		ignore        patternFlag
+	)
+	flags := flag.NewFlagSet("linkcheck", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: linkcheck [flags] URL")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&format, "format", "text", "format of the report: text, json or junit")
+	flags.StringVar(&outputFile, "output", "", "file to write the report to (default is STDOUT)")
+	flags.StringVar(&internalHosts, "internal-hosts", "", "list of hosts to crawl separated by commas (default is the host of the start URL)")
+	flags.IntVar(&maxDepth, "max-depth", 0, "max depth of links to follow with zero being unlimited")
+	flags.IntVar(&concurrency, "concurrency", 4, "number of concurrent requests")
+	flags.DurationVar(&timeout, "timeout", 30*time.Second, "time to wait for the response headers of each request")
+	flags.BoolVar(&checkAssets, "assets", false, "check the images, scripts and stylesheets of the pages too")
+	flags.BoolVar(&verbose, "verbose", false, "log every URL checked to STDERR")
+	flags.Var(&ignore, "ignore", "regular expression for URLs to skip. Can be repeated")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	logger := log.New(stderr, "", 0)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitError
+	}
+	var write func(io.Writer, *Report) error
+	switch format {
+	case "text":
+		write = writeText
+	case "json":
+		write = writeJSON
+	case "junit":
+		write = writeJUnit
+	default:
+		logger.Printf("invalid format %q, expected text, json or junit", format)
+		return exitError
+	}
+
+	startURL := flags.Arg(0)
+	start, err := crawler.NewRequest(startURL)
+	if err != nil {
+		logger.Print(err)
+		return exitError
+	}
+	hosts := []string{start.URL.Host}
+	if internalHosts != "" {
+		hosts = strings.Split(internalHosts, ",")
+	}
+
+	c := newChecker(hosts, ignore)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	opts := []crawler.Option{
+		crawler.WithHTTPTransport(transport),
+		crawler.WithConcurrentRequests(concurrency),
+		crawler.WithCheckFetch(c.checkFetch),
+	}
+	if maxDepth > 0 {
+		opts = append(opts, crawler.WithMaxDepth(maxDepth))
+	}
+	if checkAssets {
+		opts = append(opts, crawler.WithFetchAssets(crawler.CheckAssets))
+	}
+	cr, err := crawler.New(opts...)
+	if err != nil {
+		logger.Print(err)
+		return exitError
+	}
+
+	err = cr.Crawl(start.URL.String(), func(url string, res *crawler.Response, err error) error {
+		if verbose {
+			if err != nil {
+				logger.Printf("%s: %s", url, err)
+			} else {
+				logger.Printf("%s: ok", url)
+			}
+		}
+		return c.crawl(url, res, err)
+	})
+	if err != nil {
+		logger.Print(err)
+		return exitError
+	}
+
+	report := c.report(start.URL.String())
+	output := stdout
+	if outputFile != "" {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			logger.Print(err)
+			return exitError
+		}
+		defer f.Close()
+		output = f
+	}
+	if err := write(output, report); err != nil {
+		logger.Print(err)
+		return exitError
+	}
+	if len(report.Broken) > 0 {
+		return exitBroken
+	}
+	return exitOK
+}
+
+// patternFlag collects the regular expressions from the -ignore flags
+type patternFlag []*regexp.Regexp
+
+func (f *patternFlag) String() string {
+	patterns := make([]string, 0, len(*f))
+	for _, re := range *f {
+		patterns = append(patterns, re.String())
+	}
+	return strings.Join(patterns, ",")
+}
+
+func (f *patternFlag) Set(v string) error {
+	re, err := regexp.Compile(v)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, re)
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newSite(t *testing.T, external string) *httptest.Server {
+	pages := map[string]string{
+		"/": `<html><body>
+<a href="/about">About</a>
+<a href="/missing">Missing</a>
+<a href="/old">Old</a>
+<a href="` + external + `/page">External</a>
+<a href="` + external + `/gone">Gone</a>
+<img src="/broken.png">
+</body></html>`,
+		"/about": `<a href="/missing#section">still missing</a><a href="/">home</a>`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/missing", http.StatusMovedPermanently)
+			return
+		}
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+}
+
+func newExternal(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/page" {
+			w.Header().Set("Content-Type", "text/html")
+			// links and assets from external pages are not checked
+			w.Write([]byte(`<a href="/not-followed">not followed</a><img src="/not-checked.png">`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+}
+
+func TestLinkcheckJSON(t *testing.T) {
+	r := require.New(t)
+	external := newExternal(t)
+	defer external.Close()
+	site := newSite(t, external.URL)
+	defer site.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-format", "json", "-assets", site.URL}, &stdout, &stderr)
+	r.Equal(exitBroken, code, stderr.String())
+
+	var report Report
+	r.NoError(json.Unmarshal(stdout.Bytes(), &report))
+	r.Equal(site.URL+"/", report.StartURL)
+	// the start page, about, missing, the external page, gone and the broken
+	// image. Redirects are not counted.
+	r.Equal(6, report.Checked)
+	expected := []Target{
+		{
+			URL:        external.URL + "/gone",
+			StatusCode: http.StatusNotFound,
+			Error:      "404 Not Found for " + external.URL + "/gone",
+			References: []Reference{{Page: site.URL + "/", Text: "Gone", Line: 6, Column: 1}},
+		},
+		{
+			URL:        site.URL + "/broken.png",
+			StatusCode: http.StatusNotFound,
+			Error:      "404 Not Found for " + site.URL + "/broken.png",
+			References: []Reference{{Page: site.URL + "/", Tag: "img"}},
+		},
+		{
+			URL:        site.URL + "/missing",
+			StatusCode: http.StatusNotFound,
+			Error:      "404 Not Found for " + site.URL + "/missing",
+			References: []Reference{
+				{Page: site.URL + "/", Text: "Missing", Line: 3, Column: 1},
+				{Page: site.URL + "/", Link: site.URL + "/old", Text: "Old", Line: 4, Column: 1},
+				{Page: site.URL + "/about", Text: "still missing", Line: 1, Column: 1},
+			},
+		},
+	}
+	// the order depends on the ports of the servers
+	sort.Slice(expected, func(i, j int) bool { return expected[i].URL < expected[j].URL })
+	r.Equal(expected, report.Broken)
+}
+
+func TestLinkcheckIgnore(t *testing.T) {
+	r := require.New(t)
+	external := newExternal(t)
+	defer external.Close()
+	site := newSite(t, external.URL)
+	defer site.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-ignore", "/(missing|old)$", "-ignore", "^" + external.URL, site.URL}, &stdout, &stderr)
+	r.Equal(exitOK, code, stderr.String())
+	r.Equal("2 URLs checked, 0 broken\n", stdout.String())
+}
+
+func TestLinkcheckText(t *testing.T) {
+	r := require.New(t)
+	external := newExternal(t)
+	defer external.Close()
+	site := newSite(t, external.URL)
+	defer site.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-ignore", "^" + external.URL, site.URL}, &stdout, &stderr)
+	r.Equal(exitBroken, code, stderr.String())
+	r.Equal(strings.Join([]string{
+		site.URL + "/missing",
+		"  404 Not Found for " + site.URL + "/missing",
+		"  - " + site.URL + `/:3:1 "Missing"`,
+		"  - " + site.URL + `/:4:1 "Old" via ` + site.URL + "/old",
+		"  - " + site.URL + `/about:1:1 "still missing"`,
+		"",
+		"3 URLs checked, 1 broken",
+		"",
+	}, "\n"), stdout.String())
+}
+
+func TestLinkcheckJUnit(t *testing.T) {
+	r := require.New(t)
+	external := newExternal(t)
+	defer external.Close()
+	site := newSite(t, external.URL)
+	defer site.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-format", "junit", site.URL}, &stdout, &stderr)
+	r.Equal(exitBroken, code, stderr.String())
+
+	var suites junitTestSuites
+	r.NoError(xml.Unmarshal(stdout.Bytes(), &suites))
+	r.Len(suites.Suites, 2)
+	failures := make(map[string]string)
+	var tests int
+	for _, suite := range suites.Suites {
+		tests += suite.Tests
+		for _, tc := range suite.TestCases {
+			if tc.Failure != nil {
+				failures[tc.Name] = tc.Failure.Message
+			}
+		}
+	}
+	r.Equal(5, tests)
+	r.Equal(map[string]string{
+		site.URL + "/missing":  "404 Not Found for " + site.URL + "/missing",
+		external.URL + "/gone": "404 Not Found for " + external.URL + "/gone",
+	}, failures)
+}
+
+func TestLinkcheckUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, exitError, run(nil, &stdout, &stderr))
+	require.Equal(t, exitError, run([]string{"-format", "yaml", "http://example.com"}, &stdout, &stderr))
+	require.Equal(t, exitError, run([]string{"-ignore", "(", "http://example.com"}, &stdout, &stderr))
+}
+
+func TestReportUnreferencedFailures(t *testing.T) {
+	r := require.New(t)
+	c := newChecker([]string{"example.test"}, nil)
+	c.results["http://example.test/"] = Target{URL: "http://example.test/", Error: "failed"}
+	c.results["http://example.test/unreferenced"] = Target{URL: "http://example.test/unreferenced", Error: "failed"}
+
+	report := c.report("http://example.test/")
+	r.Equal(2, report.Checked)
+	r.Len(report.Broken, 1)
+	r.Equal("http://example.test/", report.Broken[0].URL)
+
+	// the JUnit report only fails the broken ones
+	var out bytes.Buffer
+	r.NoError(writeJUnit(&out, report))
+	var suites junitTestSuites
+	r.NoError(xml.Unmarshal(out.Bytes(), &suites))
+	r.Len(suites.Suites, 1)
+	r.Equal(2, suites.Suites[0].Tests)
+	r.Equal(1, suites.Suites[0].Failures)
+	for _, tc := range suites.Suites[0].TestCases {
+		r.Equal(tc.Name == "http://example.test/", tc.Failure != nil, tc.Name)
+	}
+}
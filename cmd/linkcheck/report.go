@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// writeText writes the broken links grouped by target, followed by a summary
+func writeText(w io.Writer, report *Report) error {
+	for _, target := range report.Broken {
+		fmt.Fprintf(w, "%s\n  %s\n", target.URL, target.Error)
+		for _, ref := range target.References {
+			fmt.Fprintf(w, "  - %s\n", describeRef(ref))
+		}
+		fmt.Fprintln(w)
+	}
+	_, err := fmt.Fprintf(w, "%d URLs checked, %d broken\n", report.Checked, len(report.Broken))
+	return err
+}
+
+// describeRef returns a line describing where the reference is
+func describeRef(ref Reference) string {
+	var b strings.Builder
+	b.WriteString(ref.Page)
+	if ref.Line > 0 {
+		fmt.Fprintf(&b, ":%d:%d", ref.Line, ref.Column)
+	}
+	switch {
+	case ref.Tag != "":
+		fmt.Fprintf(&b, " <%s>", ref.Tag)
+	case ref.Text != "":
+		fmt.Fprintf(&b, " %q", ref.Text)
+	}
+	if ref.Link != "" {
+		fmt.Fprintf(&b, " via %s", ref.Link)
+	}
+	return b.String()
+}
+
+func writeJSON(w io.Writer, report *Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(report)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes a JUnit XML report with a test case per URL checked,
+// grouped in a test suite per host, so CI servers show the broken links as
+// failed tests
+func writeJUnit(w io.Writer, report *Report) error {
+	broken := make(map[string]bool, len(report.Broken))
+	for _, target := range report.Broken {
+		broken[target.URL] = true
+	}
+	var suites junitTestSuites
+	index := make(map[string]int)
+	for _, target := range report.Targets {
+		host := target.URL
+		if u, err := url.Parse(target.URL); err == nil {
+			host = u.Host
+		}
+		i, ok := index[host]
+		if !ok {
+			i = len(suites.Suites)
+			index[host] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: host})
+		}
+		suite := &suites.Suites[i]
+		tc := junitTestCase{Name: target.URL, ClassName: host}
+		if broken[target.URL] {
+			var refs []string
+			for _, ref := range target.References {
+				refs = append(refs, describeRef(ref))
+			}
+			tc.Failure = &junitFailure{Message: target.Error, Text: strings.Join(refs, "\n")}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
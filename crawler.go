@@ -1,17 +1,35 @@
 package crawler
 
-import "context"
+import (
+	"context"
+	"sync"
+	"time"
+)
 
 // Simple is responsible of running a crawl, allowing you to queue new URLs to
 // be crawled and build requests to be crawled.
 type Simple struct {
 	opts []Option
+
+	checkpointDir      string
+	checkpointInterval time.Duration
+
+	mut   sync.Mutex
+	stats Stats
 }
 
 // New initialises a new crawl runner
 func New(opts ...Option) (*Simple, error) {
+	var o options
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
 	return &Simple{
-		opts: opts,
+		opts:               opts,
+		checkpointDir:      o.checkpointDir,
+		checkpointInterval: o.checkpointInterval,
 	}, nil
 }
 
@@ -24,24 +42,131 @@ func New(opts ...Option) (*Simple, error) {
 // Crawl will always add WithOneRequestPerURL to the options of the worker to
 // avoid infinite loops.
 func (s *Simple) Crawl(startURL string, crawlFn CrawlFunc) error {
+	return s.CrawlContext(context.Background(), startURL, crawlFn)
+}
+
+// CrawlContext works like Crawl, stopping the crawl when the context is done.
+//
+// When WithCheckpoint is used, any previous checkpoint in the directory is
+// discarded.
+func (s *Simple) CrawlContext(ctx context.Context, startURL string, crawlFn CrawlFunc) error {
 	req, err := NewRequest(startURL)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	s.setStats(Stats{})
+
+	if s.checkpointDir != "" {
+		cp, err := createCheckpoint(ctx, s.checkpointDir, startURL)
+		if err != nil {
+			return err
+		}
+		defer cp.Close()
+		if err := cp.queue.PushBack(req); err != nil {
+			return err
+		}
+		return s.runCheckpoint(ctx, cp, crawlFn)
+	}
+
 	// initialise the queue
 	queue := NewInMemoryQueue(ctx)
 	queue.PushBack(req)
 
-	s.opts = append(s.opts, WithOneRequestPerURL())
+	return s.run(ctx, queue, WithOneRequestPerURL(), crawlFn)
+}
+
+// Resume continues the crawl stored in the checkpoint directory dir, as
+// created by a previous crawl using WithCheckpoint. URLs visited before the
+// checkpoint will not be fetched again, and the requests that were in flight
+// when the crawl stopped are fetched again.
+func (s *Simple) Resume(dir string, crawlFn CrawlFunc) error {
+	return s.ResumeContext(context.Background(), dir, crawlFn)
+}
+
+// ResumeContext works like Resume, stopping the crawl when the context is
+// done.
+func (s *Simple) ResumeContext(ctx context.Context, dir string, crawlFn CrawlFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cp, err := loadCheckpoint(ctx, dir)
+	if err != nil {
+		return err
+	}
+	defer cp.Close()
+
+	s.setStats(cp.state.Stats)
+	return s.runCheckpoint(ctx, cp, crawlFn)
+}
+
+// Stats returns the counters of the current or last crawl
+func (s *Simple) Stats() Stats {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.stats
+}
+
+func (s *Simple) setStats(stats Stats) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.stats = stats
+}
+
+func (s *Simple) run(ctx context.Context, q Queue, once Option, crawlFn CrawlFunc) error {
+	// only pages are counted, not their assets
+	opts := append(append([]Option(nil), s.opts...), once, withPageCounter(func(err error) {
+		s.mut.Lock()
+		defer s.mut.Unlock()
+		if err == nil {
+			s.stats.Fetched++
+		} else {
+			s.stats.Failed++
+		}
+	}))
 
-	w, err := NewWorker(crawlFn, s.opts...)
+	w, err := NewWorker(crawlFn, opts...)
 	if err != nil {
 		return err
 	}
 
-	return w.Run(ctx, queue)
+	return w.Run(ctx, q)
+}
+
+// runCheckpoint runs the crawl saving the checkpoint periodically and once
+// the crawl stops
+func (s *Simple) runCheckpoint(ctx context.Context, cp *checkpoint, crawlFn CrawlFunc) error {
+	interval := s.checkpointInterval
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				cp.save(s.Stats(), false)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := s.run(ctx, cp.queue, withPageCheckFetch(cp.visited.check), crawlFn)
+	close(done)
+	wg.Wait()
+
+	if serr := cp.save(s.Stats(), err == nil); err == nil {
+		err = serr
+	}
+	return err
 }
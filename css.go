@@ -0,0 +1,251 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// ReadStylesheet extracts the assets referenced with url() and @import from
+// the CSS read from the given io reader and fills them in the response
+func ReadStylesheet(base *url.URL, r io.Reader, res *Response) error {
+	resetParsed(base, res)
+	css, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	res.Assets = cssAssets(base, string(css))
+	return nil
+}
+
+// extractStyleAsset extracts the assets from <style> blocks
+func extractStyleAsset(base *url.URL, n *html.Node) []Asset {
+	return cssAssets(base, nodeRawText(n))
+}
+
+// extractStyleAttrAssets extracts the assets from style attributes
+func extractStyleAttrAssets(base *url.URL, n *html.Node) []Asset {
+	if n.Type != html.ElementNode {
+		return nil
+	}
+	return cssAssets(base, attrValue(n, "style"))
+}
+
+// cssAssets returns the assets referenced in the CSS. References from url()
+// have the tag css>url and references from @import have the tag css>import.
+// data: URIs and references to fragments within the document are ignored.
+func cssAssets(base *url.URL, css string) []Asset {
+	var assets []Asset
+	scanCSS(css, func(tag, ref string, start, end int) {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || strings.HasPrefix(ref, "#") {
+			return
+		}
+		v, err := url.Parse(ref)
+		if err != nil || v.Scheme == "data" {
+			return
+		}
+		assets = append(assets, Asset{Tag: tag, URL: base.ResolveReference(v).String()})
+	})
+	return assets
+}
+
+// RewriteCSS returns the CSS replacing the references of its url() and
+// @import with the result of rewrite. References rewrite returns unchanged
+// are kept as they were.
+func RewriteCSS(css string, rewrite func(ref string) string) string {
+	var (
+		b    strings.Builder
+		last int
+	)
+	scanCSS(css, func(tag, ref string, start, end int) {
+		v := rewrite(ref)
+		if v == ref {
+			return
+		}
+		b.WriteString(css[last:start])
+		if hasPrefixFold(css[start:], "url(") {
+			b.WriteString("url(" + cssQuote(v) + ")")
+		} else {
+			b.WriteString(cssQuote(v))
+		}
+		last = end
+	})
+	if last == 0 {
+		return css
+	}
+	b.WriteString(css[last:])
+	return b.String()
+}
+
+// scanCSS calls fn with the references found in the CSS, along with the
+// position of the url() or the string of each of them
+func scanCSS(css string, fn func(tag, ref string, start, end int)) {
+	for i := 0; i < len(css); {
+		switch rest := css[i:]; {
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return
+			}
+			i += end + 4
+		case rest[0] == '"' || rest[0] == '\'':
+			_, n := cssString(rest)
+			i += n
+		case rest[0] == '\\':
+			// escaped characters are part of an identifier
+			i += 2
+		case hasPrefixFold(rest, "@import"):
+			i += len("@import")
+			for i < len(css) && isCSSSpace(css[i]) {
+				i++
+			}
+			if i == len(css) {
+				return
+			}
+			var (
+				ref string
+				n   int
+			)
+			switch {
+			case css[i] == '"' || css[i] == '\'':
+				ref, n = cssString(css[i:])
+			case hasPrefixFold(css[i:], "url("):
+				ref, n = cssURL(css[i:])
+			}
+			if n > 0 {
+				fn("css>import", ref, i, i+n)
+			}
+			i += n
+		case hasPrefixFold(rest, "url(") && (i == 0 || !isCSSIdent(css[i-1])):
+			ref, n := cssURL(rest)
+			fn("css>url", ref, i, i+n)
+			i += n
+		default:
+			i++
+		}
+	}
+}
+
+// cssQuote returns s as a double quoted CSS string
+func cssQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n', '\r', '\f':
+			fmt.Fprintf(&b, "\\%x ", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// cssString reads the quoted string at the start of s, returning its
+// unescaped value and the amount of bytes consumed
+func cssString(s string) (string, int) {
+	quote := s[0]
+	var b strings.Builder
+	i := 1
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1
+		case c == '\n':
+			// unterminated string
+			return b.String(), i
+		case c == '\\':
+			r, n := cssEscape(s[i:])
+			b.WriteString(r)
+			i += n
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), i
+}
+
+// cssURL reads the url() at the start of s, returning the reference and the
+// amount of bytes consumed
+func cssURL(s string) (string, int) {
+	i := len("url(")
+	for i < len(s) && isCSSSpace(s[i]) {
+		i++
+	}
+	var b strings.Builder
+	if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+		ref, n := cssString(s[i:])
+		b.WriteString(ref)
+		i += n
+	}
+	for i < len(s) && s[i] != ')' {
+		if s[i] == '\\' {
+			r, n := cssEscape(s[i:])
+			b.WriteString(r)
+			i += n
+			continue
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	if i < len(s) {
+		i++
+	}
+	return strings.TrimSpace(b.String()), i
+}
+
+// cssEscape decodes the escape sequence at the start of s
+func cssEscape(s string) (string, int) {
+	if len(s) < 2 {
+		return "", len(s)
+	}
+	if s[1] == '\n' {
+		return "", 2
+	}
+	n := 1
+	for n < len(s) && n <= 6 && isHex(s[n]) {
+		n++
+	}
+	if n == 1 {
+		r, size := utf8.DecodeRuneInString(s[1:])
+		return string(r), 1 + size
+	}
+	code, _ := strconv.ParseUint(s[1:n], 16, 32)
+	if n < len(s) && isCSSSpace(s[n]) {
+		n++
+	}
+	if code == 0 || code > utf8.MaxRune {
+		return string(utf8.RuneError), n
+	}
+	return string(rune(code)), n
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func isCSSSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isCSSIdent(c byte) bool {
+	return c == '-' || c == '_' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSSAssets(t *testing.T) {
+	base, err := url.Parse("https://example/css/style.css")
+	require.NoError(t, err)
+
+	tests := []struct {
+		css      string
+		expected []Asset
+	}{
+		{css: `a { background: url(bg.png) }`, expected: []Asset{{Tag: "css>url", URL: "https://example/css/bg.png"}}},
+		{css: `a { background: url( "b g.png" ) }`, expected: []Asset{{Tag: "css>url", URL: "https://example/css/b%20g.png"}}},
+		{css: `a { background: url(\62 g.png) }`, expected: []Asset{{Tag: "css>url", URL: "https://example/css/bg.png"}}},
+		{css: `@IMPORT 'other.css' screen;`, expected: []Asset{{Tag: "css>import", URL: "https://example/css/other.css"}}},
+		{css: `@import url(other.css);`, expected: []Asset{{Tag: "css>import", URL: "https://example/css/other.css"}}},
+		{css: `a { background: myurl(bg.png) }`},
+		{css: `a { content: "url(bg.png)" }`},
+		{css: `/* url(bg.png) */`},
+		{css: `a { background: url(`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.css, func(t *testing.T) {
+			require.Equal(t, test.expected, cssAssets(base, test.css))
+		})
+	}
+}
+
+func TestReadStylesheet(t *testing.T) {
+	r := require.New(t)
+
+	base, err := url.Parse("https://example/css/style.css")
+	r.NoError(err)
+	f, err := os.Open("testdata/css/style.css")
+	r.NoError(err)
+	defer f.Close()
+
+	var res Response
+	r.NoError(ReadStylesheet(base, f, &res))
+	r.Equal(Response{
+		URL: "https://example/css/style.css",
+		Assets: []Asset{
+			{Tag: "css>import", URL: "https://example/css/reset.css"},
+			{Tag: "css>import", URL: "https://example/css/print.css"},
+			{Tag: "css>url", URL: "https://example/fonts/example.woff2"},
+			{Tag: "css>url", URL: "https://example/fonts/example.woff"},
+			{Tag: "css>url", URL: "https://example/img/bg.png"},
+		},
+	}, res)
+}
+
+func TestFetchStylesheet(t *testing.T) {
+	r := require.New(t)
+
+	s := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer s.Close()
+
+	c, err := New()
+	r.NoError(err)
+
+	var res *Response
+	err = c.Crawl(s.URL+"/css/style.css", func(url string, r *Response, err error) error {
+		res = r
+		return err
+	})
+	r.NoError(err)
+	r.Len(res.Assets, 5)
+	r.Equal(Asset{Tag: "css>import", URL: s.URL + "/css/reset.css"}, res.Assets[0])
+	r.Contains(res.ContentType, "text/css")
+}
+
+func TestRewriteCSS(t *testing.T) {
+	rewrite := func(ref string) string {
+		if ref == "keep.png" {
+			return ref
+		}
+		return "new/" + ref
+	}
+	tests := []struct {
+		css      string
+		expected string
+	}{
+		{css: `a { background: url(bg.png) }`, expected: `a { background: url("new/bg.png") }`},
+		{css: `a { background: url( 'b"g.png' ) }`, expected: `a { background: url("new/b\"g.png") }`},
+		{css: `@import 'other.css' screen;`, expected: `@import "new/other.css" screen;`},
+		{css: `@import url(other.css);`, expected: `@import url("new/other.css");`},
+		{css: `a { background: url(keep.png) } b { background: URL(bg.png) }`, expected: `a { background: url(keep.png) } b { background: url("new/bg.png") }`},
+		{css: `/* url(bg.png) */ a { content: "url(bg.png)" }`, expected: `/* url(bg.png) */ a { content: "url(bg.png)" }`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.css, func(t *testing.T) {
+			require.Equal(t, test.expected, RewriteCSS(test.css, rewrite))
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// RobotsDirectives are the page level directives from the robots meta tag
+// and the X-Robots-Tag header
+type RobotsDirectives struct {
+	// NoIndex is set when the page asks not to be indexed
+	NoIndex bool `json:"noindex,omitempty"`
+
+	// NoFollow is set when the page asks not to follow its links
+	NoFollow bool `json:"nofollow,omitempty"`
+
+	// Directives has every directive found, lowercased. e.g: noarchive
+	Directives []string `json:"directives,omitempty"`
+}
+
+// robotsDirectiveNames are the directives taking a value after a colon, used
+// to tell them apart from user agent prefixes in X-Robots-Tag
+var robotsDirectiveNames = map[string]bool{
+	"unavailable_after": true,
+	"max-snippet":       true,
+	"max-image-preview": true,
+	"max-video-preview": true,
+}
+
+// add parses a comma separated list of directives
+func (d *RobotsDirectives) add(content string) {
+	for _, directive := range strings.Split(content, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if directive == "" {
+			continue
+		}
+		switch directive {
+		case "noindex":
+			d.NoIndex = true
+		case "nofollow":
+			d.NoFollow = true
+		case "none":
+			d.NoIndex = true
+			d.NoFollow = true
+		}
+		d.Directives = append(d.Directives, directive)
+	}
+}
+
+// addRobotsDirectives adds the directives to the response, initialising
+// Response.Robots when needed
+func addRobotsDirectives(res *Response, content string) {
+	if res.Robots == nil {
+		res.Robots = &RobotsDirectives{}
+	}
+	res.Robots.add(content)
+	if len(res.Robots.Directives) == 0 {
+		res.Robots = nil
+	}
+}
+
+// readRobotsHeader adds the directives from the X-Robots-Tag headers.
+// Headers targeting a specific user agent are ignored.
+func readRobotsHeader(res *Response, header http.Header) {
+	for _, v := range header[http.CanonicalHeaderKey("X-Robots-Tag")] {
+		if i := strings.IndexByte(v, ':'); i >= 0 {
+			name := strings.ToLower(strings.TrimSpace(v[:i]))
+			if !robotsDirectiveNames[name] && !strings.Contains(name, ",") {
+				continue
+			}
+		}
+		addRobotsDirectives(res, v)
+	}
+}
+
+// extractRobotsMeta reads the directives from <meta name="robots">
+func extractRobotsMeta(n *html.Node, res *Response) {
+	if n.Type != html.ElementNode || n.Data != "meta" {
+		return
+	}
+	var name, content string
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "name":
+			name = strings.ToLower(strings.TrimSpace(attr.Val))
+		case "content":
+			content = attr.Val
+		}
+	}
+	if name == "robots" {
+		addRobotsDirectives(res, content)
+	}
+}
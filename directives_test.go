@@ -0,0 +1,102 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRobotsHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []string
+		expected *RobotsDirectives
+	}{
+		{name: "missing", expected: nil},
+		{
+			name:     "none",
+			header:   []string{"none"},
+			expected: &RobotsDirectives{NoIndex: true, NoFollow: true, Directives: []string{"none"}},
+		},
+		{
+			name:     "multiple headers",
+			header:   []string{"NoFollow", "noarchive, unavailable_after: 25 Jun 2010 15:00:00 PST"},
+			expected: &RobotsDirectives{NoFollow: true, Directives: []string{"nofollow", "noarchive", "unavailable_after: 25 jun 2010 15:00:00 pst"}},
+		},
+		{
+			name:     "user agent specific",
+			header:   []string{"otherbot: noindex, nofollow", "noarchive"},
+			expected: &RobotsDirectives{Directives: []string{"noarchive"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var res Response
+			readRobotsHeader(&res, http.Header{"X-Robots-Tag": test.header})
+			require.Equal(t, test.expected, res.Robots)
+		})
+	}
+}
+
+func TestCrawlWithRobotsDirectives(t *testing.T) {
+	fs := http.FileServer(http.Dir("testdata"))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/loop-cycle.html" {
+			w.Header().Set("X-Robots-Tag", "nofollow")
+		}
+		fs.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+
+	tests := []struct {
+		start    string
+		opts     []Option
+		expected []string
+	}{
+		{
+			start: "/nofollow.html",
+			opts:  []Option{WithRobotsDirectives(), WithMaxDepth(3)},
+			expected: []string{
+				s.URL + "/nofollow.html",
+				s.URL + "/start-cycle.html",
+				s.URL + "/intermediate-cycle.html",
+				s.URL + "/loop-cycle.html",
+			},
+		},
+		{
+			start:    "/meta-nofollow.html",
+			opts:     []Option{WithRobotsDirectives(), WithMaxDepth(1)},
+			expected: []string{s.URL + "/meta-nofollow.html"},
+		},
+		{
+			start: "/meta-nofollow.html",
+			opts:  []Option{WithMaxDepth(1)},
+			expected: []string{
+				s.URL + "/meta-nofollow.html",
+				s.URL + "/depth-one.html",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.start, func(t *testing.T) {
+			c, err := New(test.opts...)
+			require.NoError(t, err)
+
+			var urls []string
+			err = c.Crawl(s.URL+test.start, func(url string, res *Response, err error) error {
+				require.NoError(t, err)
+				urls = append(urls, url)
+				if url == s.URL+"/loop-cycle.html" {
+					require.True(t, res.Robots.NoFollow)
+				}
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, test.expected, urls)
+		})
+	}
+}
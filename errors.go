@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HTTPError is passed to the CrawlFunc when the server responds with an
+// unexpected status code. The CrawlFunc also gets a partial Response with the
+// status, headers and timing of the response.
+type HTTPError struct {
+	// StatusCode is the HTTP status code of the response. e.g: 404
+	StatusCode int
+
+	// Status is the HTTP status of the response. e.g: 404 Not Found
+	Status string
+
+	// URL is the URL that was requested
+	URL string
+
+	// Header contains the HTTP headers of the response
+	Header http.Header
+
+	// Request is the request that failed
+	Request *Request
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s for %s", e.Status, e.URL)
+}
+
+// FetchError holds the details shared by the errors passed to the CrawlFunc
+// when a URL could not be fetched
+type FetchError struct {
+	// URL is the URL that was requested
+	URL string
+
+	// Request is the request that failed
+	Request *Request
+
+	// Err is the underlying error
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+// Cause returns the underlying error
+func (e *FetchError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// DNSError is passed to the CrawlFunc when the host of the URL could not be
+// resolved
+type DNSError struct {
+	FetchError
+}
+
+// TLSError is passed to the CrawlFunc when the TLS handshake failed, usually
+// due to an invalid certificate
+type TLSError struct {
+	FetchError
+}
+
+// TimeoutError is passed to the CrawlFunc when the request timed out
+type TimeoutError struct {
+	FetchError
+}
+
+// NetworkError is passed to the CrawlFunc when the request could not be
+// completed for any other reason, such as the connection being refused or
+// reset
+type NetworkError struct {
+	FetchError
+}
+
+// DisallowedError is passed to the CrawlFunc for the URLs that were not
+// fetched because robots.txt disallows them. It wraps ErrDisallowedByRobots.
+type DisallowedError struct {
+	FetchError
+}
+
+func (e *DisallowedError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Err, e.URL)
+}
+
+// newNetworkError classifies the error returned by the HTTP client
+func newNetworkError(req *Request, err error) error {
+	base := FetchError{URL: req.URL.String(), Request: req, Err: err}
+
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr):
+		return &DNSError{base}
+	case isTLSError(err):
+		return &TLSError{base}
+	case isTimeout(err):
+		return &TimeoutError{base}
+	default:
+		return &NetworkError{base}
+	}
+}
+
+func isTLSError(err error) bool {
+	var (
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	switch {
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr):
+		return true
+	case errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return true
+	}
+	// most handshake failures are unexported errors from crypto/tls
+	return strings.Contains(err.Error(), "tls: ")
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
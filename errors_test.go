@@ -0,0 +1,97 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchErrors(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	secure := httptest.NewTLSServer(http.NotFoundHandler())
+	defer secure.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		expected interface{}
+		timeout  time.Duration
+	}{
+		{name: "dns", url: "http://example.invalid/", expected: &DNSError{}},
+		{name: "tls", url: secure.URL + "/", expected: &TLSError{}},
+		{name: "timeout", url: slow.URL + "/", expected: &TimeoutError{}, timeout: 50 * time.Millisecond},
+		{name: "refused", url: closed.URL + "/", expected: &NetworkError{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &http.Client{
+				CheckRedirect: skipRedirects,
+				Timeout:       5 * time.Second,
+			}
+			if test.timeout > 0 {
+				c.Timeout = test.timeout
+			}
+
+			req, err := NewRequest(test.url)
+			require.NoError(t, err)
+
+			res, err := fetch(context.Background(), c, req, defaultFetchConfig)
+			require.Nil(t, res)
+			require.IsType(t, test.expected, err)
+
+			var fetchErr interface {
+				Unwrap() error
+			}
+			require.True(t, errors.As(err, &fetchErr))
+			require.Error(t, fetchErr.Unwrap())
+		})
+	}
+}
+
+func TestFetchHTTPError(t *testing.T) {
+	r := require.New(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Reason", "gone")
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer s.Close()
+
+	req, err := NewRequest(s.URL + "/page")
+	r.NoError(err)
+
+	res, err := fetch(context.Background(), &http.Client{CheckRedirect: skipRedirects}, req, defaultFetchConfig)
+	r.Error(err)
+	r.Equal("410 Gone for "+s.URL+"/page", err.Error())
+
+	var httpErr *HTTPError
+	r.True(errors.As(&RetryError{Attempts: 2, Err: err}, &httpErr))
+	r.Equal(http.StatusGone, httpErr.StatusCode)
+	r.Equal(s.URL+"/page", httpErr.URL)
+	r.Equal("gone", httpErr.Header.Get("X-Reason"))
+	r.Equal(req, httpErr.Request)
+
+	// the partial response is delivered along the error
+	r.NotNil(res)
+	r.Equal(s.URL+"/page", res.URL)
+	r.Equal(http.StatusGone, res.StatusCode)
+	r.Equal("gone", res.Header.Get("X-Reason"))
+	r.NotNil(res.Timing)
+	r.Empty(res.Links)
+}
@@ -1,20 +1,28 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"time"
 
 	"github.com/ernesto-jimenez/crawler"
+	"github.com/ernesto-jimenez/crawler/mirror"
+	"github.com/ernesto-jimenez/crawler/warc"
 	"github.com/ernesto-jimenez/httplogger"
 )
 
 type result struct {
-	Pages []*crawler.Response `json:"pages,omitempty"`
+	Pages  []*crawler.Response `json:"pages,omitempty"`
+	Assets []*crawler.Response `json:"assets,omitempty"`
 }
 
 func main() {
@@ -25,6 +33,11 @@ func main() {
 		indentJSON   bool
 		silent       bool
 		outputFile   string
+		stateDir     string
+		warcDir      string
+		mirrorDir    string
+		assets       string
+		selectors    = make(selectorFlag)
 	)
 	flag.IntVar(&maxDepth, "max-depth", 0, "max depth of links to follow with zero being unlimited (default is 0)")
 	flag.StringVar(&includeHosts, "include-hosts", "", "list of hosts to crawl separated by commas (default is the host of the start URL)")
@@ -32,6 +45,11 @@ func main() {
 	flag.BoolVar(&indentJSON, "indent", true, "whether to indent the produced JSON")
 	flag.BoolVar(&silent, "silent", false, "whether to suppress progress output to STDERR")
 	flag.StringVar(&outputFile, "output", "", "file to save the result of the crawl (default is STDOUT)")
+	flag.StringVar(&stateDir, "state-dir", "", "directory to keep the state of the crawl, resuming the unfinished crawl stored there when no start URL is given")
+	flag.StringVar(&warcDir, "warc", "", "directory to record the requests and responses of the crawl as WARC files")
+	flag.StringVar(&mirrorDir, "mirror", "", "directory to save a browsable copy of the pages and assets crawled, downloading the assets")
+	flag.StringVar(&assets, "assets", "", "fetch the assets of the pages to find the broken ones: check requests them with HEAD and download fetches them with GET (default is not fetching them)")
+	flag.Var(selectors, "select", "name=selector to store the values matched by a CSS selector, or XPath with the xpath: prefix, in the selected field of each page. Can be repeated")
 	flag.Parse()
 
 	var logOutput io.Writer
@@ -43,21 +61,77 @@ func main() {
 	log.SetOutput(logOutput)
 	log.SetFlags(0)
 
+	// a start URL starts a new crawl, discarding the state in -state-dir
 	startURL := flag.Arg(0)
-	if startURL == "" {
+	resume := startURL == "" && stateDir != "" && crawler.HasCheckpoint(stateDir)
+	if startURL == "" && !resume {
 		log.Fatal("specify a start URL")
 	}
 
+	var (
+		transport http.RoundTripper = httplogger.DefaultLoggedTransport
+		archive   *warc.Writer
+	)
+	if warcDir != "" {
+		var err error
+		archive, err = warc.NewWriter(warcDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		transport = warc.NewTransport(transport, archive)
+	}
+
 	opts := []crawler.Option{
-		crawler.WithHTTPTransport(httplogger.DefaultLoggedTransport),
+		crawler.WithHTTPTransport(transport),
 		crawler.WithMaxDepth(maxDepth),
 		crawler.WithExcludedHosts(strings.Split(excludeHosts, ",")...),
 	}
 
+	if archive != nil {
+		// the archive only records the part of the bodies read, so keep
+		// them to read them completely
+		opts = append(opts, crawler.WithKeepBody())
+	}
+
 	if includeHosts != "" {
 		opts = append(opts, crawler.WithAllowedHosts(strings.Split(includeHosts, ",")...))
 	}
 
+	if len(selectors) > 0 {
+		opts = append(opts, crawler.WithSelectors(selectors))
+	}
+
+	var site *mirror.Mirror
+	if mirrorDir != "" {
+		var err error
+		site, err = mirror.New(mirrorDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// the mirror needs the assets downloaded to save them
+		switch assets {
+		case "":
+			assets = "download"
+		case "check":
+			log.Fatal("-mirror needs the assets downloaded, it cannot be used with -assets check")
+		}
+		opts = append(opts, crawler.WithKeepBody())
+	}
+
+	switch assets {
+	case "":
+	case "check":
+		opts = append(opts, crawler.WithFetchAssets(crawler.CheckAssets))
+	case "download":
+		opts = append(opts, crawler.WithFetchAssets(crawler.DownloadAssets))
+	default:
+		log.Fatalf("invalid -assets %q, expected check or download", assets)
+	}
+
+	if stateDir != "" {
+		opts = append(opts, crawler.WithCheckpoint(stateDir, 10*time.Second))
+	}
+
 	cr, err := crawler.New(opts...)
 	if err != nil {
 		log.Fatal(err)
@@ -75,17 +149,58 @@ func main() {
 		output = f
 	}
 
+	// stop the crawl on interrupt so the checkpoint is saved
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		log.Print("interrupted, stopping the crawl")
+		cancel()
+	}()
+
 	var result result
 
-	err = cr.Crawl(startURL, func(url string, res *crawler.Response, err error) error {
+	var crawlFn crawler.CrawlFunc = func(url string, res *crawler.Response, err error) error {
 		if err != nil {
 			log.Printf("error: %s", err.Error())
 			return nil
 		}
-		result.Pages = append(result.Pages, res)
+		if res.Asset {
+			result.Assets = append(result.Assets, res)
+		} else {
+			result.Pages = append(result.Pages, res)
+		}
 		return nil
-	})
-	if err != nil {
+	}
+	if site != nil {
+		crawlFn = site.CrawlFunc(crawlFn)
+	}
+	if archive != nil {
+		crawlFn = archive.CrawlFunc(crawlFn)
+	}
+	if resume {
+		// the pages fetched before the crawl stopped are not fetched again,
+		// so the output only has the pages fetched since resuming
+		log.Printf("resuming crawl from %s, the output will only include the pages fetched from now on", stateDir)
+		err = cr.ResumeContext(ctx, stateDir, crawlFn)
+	} else {
+		err = cr.CrawlContext(ctx, startURL, crawlFn)
+	}
+	if archive != nil {
+		if err := archive.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if site != nil {
+		if err := site.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err == context.Canceled && stateDir != "" {
+		log.Printf("crawl state saved to %s", stateDir)
+	} else if err != nil {
 		log.Fatal(err)
 	}
 
@@ -98,3 +213,23 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// selectorFlag collects the name=selector pairs from the -select flags
+type selectorFlag map[string]string
+
+func (f selectorFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for name, sel := range f {
+		pairs = append(pairs, name+"="+sel)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f selectorFlag) Set(v string) error {
+	i := strings.IndexByte(v, '=')
+	if i <= 0 {
+		return fmt.Errorf("expected name=selector, got %q", v)
+	}
+	f[strings.TrimSpace(v[:i])] = v[i+1:]
+	return nil
+}
@@ -0,0 +1,58 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+
+	"golang.org/x/net/html"
+)
+
+// Extractor extracts custom data from the HTML pages visited by the crawler
+// without parsing them again. Extractors write their values in Response.Data
+// and can append links to Response.Links for the crawler to follow. Appended
+// links must have an absolute URL.
+type Extractor interface {
+	// Extract is called with the parsed document and the base URL used to
+	// resolve the relative URLs within it, taking <base href> into account
+	Extract(base *url.URL, doc *html.Node, res *Response) error
+}
+
+// ExtractorFunc is an adapter to use ordinary functions as Extractors
+type ExtractorFunc func(base *url.URL, doc *html.Node, res *Response) error
+
+// Extract calls f(base, doc, res)
+func (f ExtractorFunc) Extract(base *url.URL, doc *html.Node, res *Response) error {
+	return f(base, doc, res)
+}
+
+// ExtractError is passed to the CrawlFunc along with the Response when an
+// Extractor fails. The links from the page are not followed.
+type ExtractError struct {
+	FetchError
+}
+
+func (e *ExtractError) Error() string {
+	return fmt.Sprintf("extracting data from %s: %s", e.URL, e.Err)
+}
+
+// extract runs the extractors on the parsed document of the response, which
+// is released afterwards
+func (w *Worker) extract(req *Request, res *Response) error {
+	doc, base := res.doc, res.docBase
+	res.doc, res.docBase = nil, nil
+	if doc == nil || len(w.extractors) == 0 {
+		return nil
+	}
+	res.Data = make(map[string]interface{})
+	defer func() {
+		if len(res.Data) == 0 {
+			res.Data = nil
+		}
+	}()
+	for _, e := range w.extractors {
+		if err := e.Extract(base, doc, res); err != nil {
+			return &ExtractError{FetchError{URL: req.URL.String(), Request: req, Err: err}}
+		}
+	}
+	return nil
+}
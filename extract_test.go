@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestWithExtractor(t *testing.T) {
+	r := require.New(t)
+
+	s := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer s.Close()
+
+	anchors := ExtractorFunc(func(base *url.URL, doc *html.Node, res *Response) error {
+		var count int
+		var walk func(*html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.ElementNode && n.Data == "a" {
+				count++
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(doc)
+		res.Data["anchors"] = count
+		return nil
+	})
+	extraLink := ExtractorFunc(func(base *url.URL, doc *html.Node, res *Response) error {
+		if res.URL == s.URL+"/depth-one.html" {
+			u, err := base.Parse("nofollow.html")
+			r.NoError(err)
+			res.Links = append(res.Links, Link{URL: u.String()})
+		}
+		return nil
+	})
+
+	c, err := New(WithMaxDepth(1), WithExtractor(anchors), WithExtractor(extraLink))
+	r.NoError(err)
+
+	responses := make(map[string]*Response)
+	err = c.Crawl(s.URL+"/depth-one.html", func(url string, res *Response, err error) error {
+		r.NoError(err)
+		responses[url] = res
+		return nil
+	})
+	r.NoError(err)
+
+	r.Equal(map[string]interface{}{"anchors": 1}, responses[s.URL+"/depth-one.html"].Data)
+	r.Contains(responses, s.URL+"/nofollow.html")
+	r.Equal(map[string]interface{}{"anchors": 3}, responses[s.URL+"/nofollow.html"].Data)
+}
+
+func TestWithExtractorError(t *testing.T) {
+	r := require.New(t)
+
+	s := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer s.Close()
+
+	errExtract := errors.New("no price")
+	c, err := New(WithExtractor(ExtractorFunc(func(base *url.URL, doc *html.Node, res *Response) error {
+		return errExtract
+	})))
+	r.NoError(err)
+
+	var calls int
+	err = c.Crawl(s.URL+"/depth-one.html", func(url string, res *Response, err error) error {
+		calls++
+		var extractErr *ExtractError
+		r.True(errors.As(err, &extractErr))
+		r.True(errors.Is(err, errExtract))
+		r.NotNil(res)
+		r.Nil(res.Data)
+		return nil
+	})
+	r.NoError(err)
+	r.Equal(1, calls)
+}
+
+func TestWithExtractorNil(t *testing.T) {
+	_, err := New(WithExtractor(nil))
+	require.Error(t, err)
+}
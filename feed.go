@@ -0,0 +1,230 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/charset"
+)
+
+// rssFeed covers RSS 2.0 and the RDF based RSS 0.9 and 1.0, which has the
+// items outside the channel
+type rssFeed struct {
+	Channel struct {
+		Links []rssLink `xml:"link"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title     string         `xml:"title"`
+	Links     []rssLink      `xml:"link"`
+	GUID      rssGUID        `xml:"guid"`
+	Enclosure []rssEnclosure `xml:"enclosure"`
+}
+
+// rssLink is either a RSS <link> or an <atom:link> within the feed
+type rssLink struct {
+	URL  string `xml:",chardata"`
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink string `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type atomFeed struct {
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title string     `xml:"title"`
+	Links []atomLink `xml:"link"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// ReadFeed extracts the links from the RSS or Atom feed read from the given
+// io reader and fills them in the response. The links of the items have the
+// title of the item as Text, while enclosures are added as assets with the
+// tags rss>enclosure and atom>enclosure. Only the alternate links of Atom
+// entries are followed.
+func ReadFeed(base *url.URL, r io.Reader, res *Response) error {
+	resetParsed(base, res)
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	root, err := xmlRoot(src)
+	if err != nil {
+		return err
+	}
+	switch root {
+	case "rss", "RDF":
+		return readRSS(base, src, res)
+	case "feed":
+		return readAtom(base, src, res)
+	}
+	return errors.Errorf("unexpected feed root element %q", root)
+}
+
+// readXML reads XML documents of unknown type, using the root element to
+// pick the parser. Documents other than feeds and XHTML have no links.
+func readXML(base *url.URL, r io.Reader, res *Response) error {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	root, err := xmlRoot(src)
+	if err != nil {
+		resetParsed(base, res)
+		return err
+	}
+	switch root {
+	case "html":
+		return readHTML(base, bytes.NewReader(src), res)
+	case "rss", "RDF", "feed":
+		return ReadFeed(base, bytes.NewReader(src), res)
+	}
+	resetParsed(base, res)
+	return nil
+}
+
+func newXMLDecoder(src []byte) *xml.Decoder {
+	dec := xml.NewDecoder(bytes.NewReader(src))
+	dec.CharsetReader = charset.NewReaderLabel
+	dec.Strict = false
+	return dec
+}
+
+// xmlRoot returns the local name of the root element of the document
+func xmlRoot(src []byte) (string, error) {
+	dec := newXMLDecoder(src)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", errors.Wrap(err, "parsing XML")
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+func readRSS(base *url.URL, src []byte, res *Response) error {
+	var feed rssFeed
+	if err := newXMLDecoder(src).Decode(&feed); err != nil {
+		return errors.Wrap(err, "parsing RSS feed")
+	}
+	for _, l := range feed.Channel.Links {
+		addFeedLink(base, res, Link{URL: l.url(), Rel: l.Rel})
+	}
+	for _, item := range append(feed.Channel.Items, feed.Items...) {
+		title := strings.Join(strings.Fields(item.Title), " ")
+		var hasLink bool
+		for _, l := range item.Links {
+			hasLink = addFeedLink(base, res, Link{URL: l.url(), Rel: l.Rel, Text: title}) || hasLink
+		}
+		// the guid is the permalink of items without link unless stated
+		if !hasLink && !strings.EqualFold(strings.TrimSpace(item.GUID.IsPermaLink), "false") {
+			addFeedLink(base, res, Link{URL: item.GUID.Value, Text: title})
+		}
+		for _, enc := range item.Enclosure {
+			addFeedAsset(base, res, Asset{Tag: "rss>enclosure", URL: enc.URL, Type: enc.Type})
+		}
+	}
+	return nil
+}
+
+func (l rssLink) url() string {
+	if s := strings.TrimSpace(l.URL); s != "" {
+		return s
+	}
+	return l.Href
+}
+
+func readAtom(base *url.URL, src []byte, res *Response) error {
+	var feed atomFeed
+	if err := newXMLDecoder(src).Decode(&feed); err != nil {
+		return errors.Wrap(err, "parsing Atom feed")
+	}
+	for _, l := range feed.Links {
+		if rel := atomRel(l); rel == "alternate" || atomPageRels[rel] {
+			addFeedLink(base, res, Link{URL: l.Href, Rel: l.Rel})
+		}
+	}
+	for _, entry := range feed.Entries {
+		title := strings.Join(strings.Fields(entry.Title), " ")
+		for _, l := range entry.Links {
+			switch atomRel(l) {
+			case "alternate":
+				addFeedLink(base, res, Link{URL: l.Href, Rel: l.Rel, Text: title})
+			case "enclosure":
+				addFeedAsset(base, res, Asset{Tag: "atom>enclosure", URL: l.Href, Rel: l.Rel, Type: l.Type})
+			}
+		}
+	}
+	return nil
+}
+
+// atomPageRels are the rels of the links to other pages of an Atom feed,
+// which are followed along with the alternate links. Other links, like self,
+// edit or replies, point to the feed itself or to APIs and are skipped.
+var atomPageRels = map[string]bool{
+	"first":    true,
+	"last":     true,
+	"next":     true,
+	"previous": true,
+	"prev":     true,
+}
+
+// atomRel returns the rel of the link, which is alternate when missing
+func atomRel(l atomLink) string {
+	rel := strings.ToLower(strings.TrimSpace(l.Rel))
+	if rel == "" {
+		return "alternate"
+	}
+	return rel
+}
+
+// addFeedLink adds the link to the response when its URL is valid, returning
+// whether it was added
+func addFeedLink(base *url.URL, res *Response, link Link) bool {
+	if strings.TrimSpace(link.URL) == "" {
+		return false
+	}
+	link.URL = linkURL(base, link.URL)
+	if link.URL == "" {
+		return false
+	}
+	link.Rel = strings.TrimSpace(link.Rel)
+	res.Links = append(res.Links, link)
+	return true
+}
+
+func addFeedAsset(base *url.URL, res *Response, asset Asset) {
+	v, err := url.Parse(strings.TrimSpace(asset.URL))
+	if err != nil || asset.URL == "" {
+		return
+	}
+	asset.URL = base.ResolveReference(v).String()
+	res.Assets = append(res.Assets, asset)
+}
@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFeed(t *testing.T) {
+	base, err := url.Parse("https://example/feed")
+	require.NoError(t, err)
+
+	tests := []struct {
+		file    string
+		expects Response
+	}{
+		{
+			file: "testdata/feed.rss",
+			expects: Response{
+				URL: "https://example/feed",
+				Links: []Link{
+					{URL: "https://example/blog/"},
+					{URL: "https://example/feed.rss", Rel: "self"},
+					{URL: "https://example/blog/first.html", Text: "First post"},
+					{URL: "https://example/blog/podcast.html", Text: "Podcast"},
+				},
+				Assets: []Asset{
+					{Tag: "rss>enclosure", URL: "https://example/media/episode.mp3", Type: "audio/mpeg"},
+				},
+			},
+		},
+		{
+			file: "testdata/feed.atom",
+			expects: Response{
+				URL: "https://example/feed",
+				Links: []Link{
+					{URL: "https://example/blog/"},
+					{URL: "https://example/feed.atom?page=2", Rel: "next"},
+					{URL: "https://example/blog/first.html", Rel: "alternate", Text: "First post"},
+				},
+				Assets: []Asset{
+					{Tag: "atom>enclosure", URL: "https://example/img/first.png", Rel: "enclosure", Type: "image/png"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			f, err := os.Open(test.file)
+			require.NoError(t, err)
+			defer f.Close()
+
+			var res Response
+			require.NoError(t, ReadFeed(base, f, &res))
+			require.Equal(t, test.expects, res)
+		})
+	}
+}
+
+func TestReadFeedInvalid(t *testing.T) {
+	base, err := url.Parse("https://example/feed")
+	require.NoError(t, err)
+
+	for _, doc := range []string{`<urlset></urlset>`, `not xml`} {
+		var res Response
+		require.Error(t, ReadFeed(base, strings.NewReader(doc), &res), doc)
+	}
+}
@@ -0,0 +1,383 @@
+package crawler
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// compactThreshold is the minimum amount of records in the log before
+// FileQueue considers compacting it
+const compactThreshold = 1024
+
+// FileQueue is a Queue persisted to an append-only log on disk, allowing a
+// crawl to be resumed after the process stops.
+//
+// Every push, pop and finish is appended to the log. When the queue is
+// opened again, the requests that were popped but never finished are queued
+// again ahead of the pending ones.
+type FileQueue struct {
+	ctx  context.Context
+	path string
+
+	mut        sync.Mutex
+	f          *os.File
+	w          *bufio.Writer
+	nextID     int64
+	pending    *list.List
+	inFlight   map[int64]*fileQueueItem
+	records    int
+	changed    chan struct{}
+	err        error
+	closed     bool
+	unfinished int
+
+	// requeued has the URLs that were in flight when the queue was loaded
+	requeued []string
+}
+
+type fileQueueItem struct {
+	ID        int64       `json:"id"`
+	URL       string      `json:"url,omitempty"`
+	Depth     int         `json:"depth,omitempty"`
+	Redirects int         `json:"redirects,omitempty"`
+	Attempts  int         `json:"attempts,omitempty"`
+	Chain     []Redirect  `json:"chain,omitempty"`
+	Sitemap   *SitemapURL `json:"sitemap,omitempty"`
+}
+
+type fileQueueRecord struct {
+	Op string `json:"op"`
+	fileQueueItem
+}
+
+const (
+	fileQueuePush   = "push"
+	fileQueuePop    = "pop"
+	fileQueueFinish = "finish"
+)
+
+// NewFileQueue opens the queue stored in the file at path, creating it when
+// it does not exist. Requests left in flight by a previous run are queued
+// again.
+func NewFileQueue(ctx context.Context, path string) (*FileQueue, error) {
+	q := &FileQueue{
+		ctx:      ctx,
+		path:     path,
+		pending:  list.New(),
+		inFlight: make(map[int64]*fileQueueItem),
+		changed:  make(chan struct{}),
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// load replays the log to rebuild the state of the queue
+func (q *FileQueue) load() error {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var (
+		items   = make(map[int64]*list.Element)
+		inPop   = make(map[int64]bool)
+		pending = list.New()
+		popped  = list.New()
+	)
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		var rec fileQueueRecord
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			// a partially written record from a crash
+			continue
+		}
+		if rec.ID >= q.nextID {
+			q.nextID = rec.ID + 1
+		}
+		switch rec.Op {
+		case fileQueuePush:
+			item := rec.fileQueueItem
+			items[rec.ID] = pending.PushBack(&item)
+		case fileQueuePop:
+			if e, ok := items[rec.ID]; ok && !inPop[rec.ID] {
+				item := pending.Remove(e).(*fileQueueItem)
+				items[rec.ID] = popped.PushBack(item)
+				inPop[rec.ID] = true
+			}
+		case fileQueueFinish:
+			if e, ok := items[rec.ID]; ok {
+				if inPop[rec.ID] {
+					popped.Remove(e)
+				} else {
+					pending.Remove(e)
+				}
+				delete(items, rec.ID)
+				delete(inPop, rec.ID)
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return errors.Wrapf(err, "reading queue %s", q.path)
+	}
+
+	// requests in flight when the previous run stopped go first
+	for e := popped.Front(); e != nil; e = e.Next() {
+		q.requeued = append(q.requeued, e.Value.(*fileQueueItem).URL)
+	}
+	popped.PushBackList(pending)
+	q.pending = popped
+	q.unfinished = q.pending.Len()
+	return nil
+}
+
+// compact rewrites the log with only the unfinished requests
+func (q *FileQueue) compact() error {
+	tmp := q.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	records := 0
+	write := func(rec fileQueueRecord) {
+		if err == nil {
+			err = enc.Encode(rec)
+			records++
+		}
+	}
+	for e := q.pending.Front(); e != nil; e = e.Next() {
+		write(fileQueueRecord{Op: fileQueuePush, fileQueueItem: *e.Value.(*fileQueueItem)})
+	}
+	for _, item := range q.inFlight {
+		write(fileQueueRecord{Op: fileQueuePush, fileQueueItem: *item})
+		write(fileQueueRecord{Op: fileQueuePop, fileQueueItem: fileQueueItem{ID: item.ID}})
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "compacting queue %s", q.path)
+	}
+	if q.f != nil {
+		q.f.Close()
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(q.path))
+
+	q.f, err = os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	q.w = bufio.NewWriter(q.f)
+	q.records = records
+	return nil
+}
+
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// append writes a record to the log. It must be called holding the lock.
+func (q *FileQueue) append(rec fileQueueRecord) error {
+	if q.err != nil {
+		return q.err
+	}
+	if q.closed {
+		return errors.New("queue is closed")
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if _, err := q.w.Write(b); err != nil {
+		q.err = err
+		return err
+	}
+	if err := q.w.Flush(); err != nil {
+		q.err = err
+		return err
+	}
+	q.records++
+	return nil
+}
+
+// maybeCompact compacts the log once most of its records are obsolete. It
+// must be called holding the lock.
+func (q *FileQueue) maybeCompact() {
+	if q.err != nil || q.closed {
+		return
+	}
+	if q.records > compactThreshold && q.records > 4*q.unfinished {
+		q.err = q.compact()
+	}
+}
+
+// notify wakes up the callers waiting on PopFront. It must be called holding
+// the lock.
+func (q *FileQueue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// PushBack adds a request to the queue
+func (q *FileQueue) PushBack(req *Request) error {
+	if req.finished {
+		panic("requeueing finished request is forbidden")
+	}
+	if err := q.ctx.Err(); err != nil {
+		return err
+	}
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	item := &fileQueueItem{
+		ID:        q.nextID,
+		URL:       req.URL.String(),
+		Depth:     req.depth,
+		Redirects: req.redirects,
+		Attempts:  req.attempts,
+		Chain:     req.chain,
+		Sitemap:   req.sitemap,
+	}
+	if err := q.append(fileQueueRecord{Op: fileQueuePush, fileQueueItem: *item}); err != nil {
+		return err
+	}
+	q.nextID++
+	q.pending.PushBack(item)
+	q.unfinished++
+	q.maybeCompact()
+	q.notify()
+	return nil
+}
+
+// PopFront gets the next request from the queue.
+// It will return a nil request and a nil error once all the requests in the
+// queue have been finished.
+func (q *FileQueue) PopFront() (*Request, error) {
+	for {
+		q.mut.Lock()
+		if front := q.pending.Front(); front != nil {
+			req, err := q.pop(front)
+			q.mut.Unlock()
+			if req == nil && err == nil {
+				// the request was invalid and dropped
+				continue
+			}
+			return req, err
+		}
+		if q.unfinished == 0 || q.closed {
+			q.mut.Unlock()
+			return nil, nil
+		}
+		changed := q.changed
+		q.mut.Unlock()
+
+		select {
+		case <-changed:
+		case <-q.ctx.Done():
+			return nil, q.ctx.Err()
+		}
+	}
+}
+
+// pop moves the item to the requests in flight. Items with invalid URLs are
+// dropped, returning a nil request and a nil error.
+func (q *FileQueue) pop(e *list.Element) (*Request, error) {
+	item := e.Value.(*fileQueueItem)
+	req, err := NewRequest(item.URL)
+	if err != nil {
+		log.Printf("crawler: dropping queued request %d: %s", item.ID, err)
+		q.pending.Remove(e)
+		q.unfinished--
+		q.notify()
+		if err := q.append(fileQueueRecord{Op: fileQueueFinish, fileQueueItem: fileQueueItem{ID: item.ID}}); err != nil {
+			return nil, err
+		}
+		q.maybeCompact()
+		return nil, nil
+	}
+	if err := q.append(fileQueueRecord{Op: fileQueuePop, fileQueueItem: fileQueueItem{ID: item.ID}}); err != nil {
+		return nil, err
+	}
+	q.pending.Remove(e)
+	q.inFlight[item.ID] = item
+	q.maybeCompact()
+
+	req.depth = item.Depth
+	req.redirects = item.Redirects
+	req.attempts = item.Attempts
+	req.chain = item.Chain
+	req.sitemap = item.Sitemap
+	req.onFinish = func() {
+		q.mut.Lock()
+		defer q.mut.Unlock()
+		if _, ok := q.inFlight[item.ID]; !ok {
+			return
+		}
+		delete(q.inFlight, item.ID)
+		q.unfinished--
+		q.append(fileQueueRecord{Op: fileQueueFinish, fileQueueItem: fileQueueItem{ID: item.ID}})
+		q.maybeCompact()
+		q.notify()
+	}
+	return req, nil
+}
+
+// Len returns the amount of requests waiting in the queue and the amount of
+// requests popped that have not finished yet
+func (q *FileQueue) Len() (pending, inFlight int) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	return q.pending.Len(), len(q.inFlight)
+}
+
+// Close flushes the log to disk and releases the file. Requests in flight
+// will be queued again the next time the queue is opened.
+func (q *FileQueue) Close() error {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.notify()
+	err := q.w.Flush()
+	if serr := q.f.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := q.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
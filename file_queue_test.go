@@ -0,0 +1,229 @@
+package crawler
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func tempQueuePath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "crawler-queue")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "queue.log")
+}
+
+func newTestRequest(t *testing.T, uri string, depth int) *Request {
+	req, err := NewRequest(uri)
+	require.NoError(t, err)
+	req.depth = depth
+	return req
+}
+
+func TestFileQueue(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	q, err := NewFileQueue(ctx, tempQueuePath(t))
+	r.NoError(err)
+	defer q.Close()
+
+	var req *Request
+
+	err = q.PushBack(newTestRequest(t, "http://example.test/1", 1))
+	r.NoError(err)
+
+	req, err = q.PopFront()
+	r.NoError(err)
+	r.Equal(1, req.depth)
+
+	err = q.PushBack(newTestRequest(t, "http://example.test/2", 2))
+	r.NoError(err)
+
+	req.Finish()
+
+	err = q.PushBack(newTestRequest(t, "http://example.test/3", 3))
+	r.NoError(err)
+
+	req, err = q.PopFront()
+	r.NoError(err)
+	r.Equal(2, req.depth)
+	req.Finish()
+
+	req, err = q.PopFront()
+	r.NoError(err)
+	r.Equal(3, req.depth)
+	req.Finish()
+
+	req, err = q.PopFront()
+	r.NoError(err)
+	r.Nil(req)
+}
+
+func TestFileQueueWaitsForInFlight(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	q, err := NewFileQueue(ctx, tempQueuePath(t))
+	r.NoError(err)
+	defer q.Close()
+
+	r.NoError(q.PushBack(newTestRequest(t, "http://example.test/1", 0)))
+	first, err := q.PopFront()
+	r.NoError(err)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.PushBack(newTestRequest(t, "http://example.test/2", 1))
+		first.Finish()
+	}()
+
+	req, err := q.PopFront()
+	r.NoError(err)
+	r.Equal("http://example.test/2", req.URL.String())
+	req.Finish()
+
+	req, err = q.PopFront()
+	r.NoError(err)
+	r.Nil(req)
+}
+
+func TestFileQueueResume(t *testing.T) {
+	r := require.New(t)
+	path := tempQueuePath(t)
+
+	q, err := NewFileQueue(context.Background(), path)
+	r.NoError(err)
+	for i, uri := range []string{"http://example.test/1", "http://example.test/2", "http://example.test/3"} {
+		req := newTestRequest(t, uri, i)
+		req.redirects = i
+		r.NoError(q.PushBack(req))
+	}
+	done, err := q.PopFront()
+	r.NoError(err)
+	done.Finish()
+	inFlight, err := q.PopFront()
+	r.NoError(err)
+	r.NoError(q.Close())
+
+	q, err = NewFileQueue(context.Background(), path)
+	r.NoError(err)
+	defer q.Close()
+
+	pending, running := q.Len()
+	r.Equal(2, pending)
+	r.Equal(0, running)
+
+	req, err := q.PopFront()
+	r.NoError(err)
+	r.Equal(inFlight.URL.String(), req.URL.String())
+	r.Equal(1, req.depth)
+	r.Equal(1, req.redirects)
+	req.Finish()
+
+	req, err = q.PopFront()
+	r.NoError(err)
+	r.Equal("http://example.test/3", req.URL.String())
+	r.Equal(2, req.depth)
+	r.Equal(2, req.redirects)
+	req.Finish()
+
+	req, err = q.PopFront()
+	r.NoError(err)
+	r.Nil(req)
+}
+
+func TestFileQueueSkipsInvalidRequests(t *testing.T) {
+	r := require.New(t)
+	path := tempQueuePath(t)
+	log := `{"op":"push","id":1,"url":"http://[::1"}
+{"op":"push","id":2,"url":"http://example.test/2"}
+`
+	r.NoError(ioutil.WriteFile(path, []byte(log), 0644))
+
+	q, err := NewFileQueue(context.Background(), path)
+	r.NoError(err)
+
+	// the invalid request is skipped
+	req, err := q.PopFront()
+	r.NoError(err)
+	r.Equal("http://example.test/2", req.URL.String())
+	r.NoError(q.Close())
+
+	// the invalid request is not queued again
+	q, err = NewFileQueue(context.Background(), path)
+	r.NoError(err)
+	defer q.Close()
+	pending, _ := q.Len()
+	r.Equal(1, pending)
+	req, err = q.PopFront()
+	r.NoError(err)
+	r.Equal("http://example.test/2", req.URL.String())
+	req.Finish()
+
+	req, err = q.PopFront()
+	r.NoError(err)
+	r.Nil(req)
+}
+
+func TestFileQueueCompaction(t *testing.T) {
+	r := require.New(t)
+	path := tempQueuePath(t)
+
+	q, err := NewFileQueue(context.Background(), path)
+	r.NoError(err)
+	for i := 0; i < 2*compactThreshold; i++ {
+		r.NoError(q.PushBack(newTestRequest(t, "http://example.test/", i)))
+		req, err := q.PopFront()
+		r.NoError(err)
+		req.Finish()
+	}
+	r.NoError(q.PushBack(newTestRequest(t, "http://example.test/last", 7)))
+	r.NoError(q.Close())
+
+	info, err := os.Stat(path)
+	r.NoError(err)
+	r.True(info.Size() < 100*int64(compactThreshold), "log was not compacted: %d bytes", info.Size())
+
+	q, err = NewFileQueue(context.Background(), path)
+	r.NoError(err)
+	defer q.Close()
+
+	req, err := q.PopFront()
+	r.NoError(err)
+	r.Equal("http://example.test/last", req.URL.String())
+	r.Equal(7, req.depth)
+}
+
+func TestCrawlWithFileQueue(t *testing.T) {
+	r := require.New(t)
+
+	s := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer s.Close()
+
+	q, err := NewFileQueue(context.Background(), tempQueuePath(t))
+	r.NoError(err)
+	defer q.Close()
+	r.NoError(q.PushBack(newTestRequest(t, s.URL+"/start-cycle.html", 0)))
+
+	var urls []string
+	w, err := NewWorker(func(url string, res *Response, err error) error {
+		urls = append(urls, url)
+		return err
+	}, WithOneRequestPerURL())
+	r.NoError(err)
+
+	r.NoError(w.Run(context.Background(), q))
+	r.Equal([]string{
+		s.URL + "/start-cycle.html",
+		s.URL + "/intermediate-cycle.html",
+		s.URL + "/loop-cycle.html",
+	}, urls)
+}
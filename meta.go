@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Meta has the metadata of an HTML page
+type Meta struct {
+	// Title is the text of the <title> tag
+	Title string `json:"title,omitempty"`
+
+	// Description is the content of <meta name="description">
+	Description string `json:"description,omitempty"`
+
+	// Canonical is the URL from <link rel="canonical">
+	Canonical string `json:"canonical,omitempty"`
+
+	// Alternates has the <link rel="alternate"> tags. e.g: translations
+	Alternates []Alternate `json:"alternates,omitempty"`
+
+	// Lang is the lang attribute of the <html> tag
+	Lang string `json:"lang,omitempty"`
+
+	// Headings has the outline of the page from the h1 to h6 tags
+	Headings []Heading `json:"headings,omitempty"`
+
+	// OpenGraph has the og: meta tags, in the order found
+	OpenGraph []MetaProperty `json:"open_graph,omitempty"`
+
+	// Twitter has the twitter: card meta tags, in the order found
+	Twitter []MetaProperty `json:"twitter,omitempty"`
+}
+
+// Alternate is an alternate version of the page from <link rel="alternate">
+type Alternate struct {
+	// URL of the alternate version
+	URL string `json:"url"`
+
+	// Hreflang is the language of the alternate version. e.g: es-ES
+	Hreflang string `json:"hreflang,omitempty"`
+
+	// Type is the media type of the alternate version. e.g: application/rss+xml
+	Type string `json:"type,omitempty"`
+
+	// Media is the media query the alternate version is meant for
+	Media string `json:"media,omitempty"`
+}
+
+// Heading is a single h1 to h6 tag
+type Heading struct {
+	// Level of the heading, from 1 to 6
+	Level int `json:"level"`
+
+	// Text of the heading with whitespace collapsed
+	Text string `json:"text"`
+}
+
+// MetaProperty is a meta tag from the Open Graph or Twitter card protocols
+type MetaProperty struct {
+	// Property is the name of the property. e.g: og:title
+	Property string `json:"property"`
+
+	// Content is the value of the property
+	Content string `json:"content"`
+}
+
+var headingLevels = map[atom.Atom]int{
+	atom.H1: 1,
+	atom.H2: 2,
+	atom.H3: 3,
+	atom.H4: 4,
+	atom.H5: 5,
+	atom.H6: 6,
+}
+
+// extractMeta adds the metadata found in the node to Response.Meta,
+// initialising it when needed
+func extractMeta(base *url.URL, n *html.Node, res *Response) {
+	// elements within svg and math have their own namespace
+	if n.Type != html.ElementNode || n.Namespace != "" {
+		return
+	}
+	meta := func() *Meta {
+		if res.Meta == nil {
+			res.Meta = &Meta{}
+		}
+		return res.Meta
+	}
+	switch n.DataAtom {
+	case atom.Html:
+		if lang := strings.TrimSpace(attrValue(n, "lang")); lang != "" {
+			meta().Lang = lang
+		}
+	case atom.Title:
+		if res.Meta == nil || res.Meta.Title == "" {
+			if title := nodeText(n); title != "" {
+				meta().Title = title
+			}
+		}
+	case atom.Meta:
+		extractMetaTag(n, meta)
+	case atom.Link:
+		extractMetaLink(base, n, meta)
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		meta().Headings = append(meta().Headings, Heading{
+			Level: headingLevels[n.DataAtom],
+			Text:  nodeText(n),
+		})
+	}
+}
+
+func extractMetaTag(n *html.Node, meta func() *Meta) {
+	name := strings.ToLower(strings.TrimSpace(attrValue(n, "name")))
+	property := strings.ToLower(strings.TrimSpace(attrValue(n, "property")))
+	content := strings.TrimSpace(attrValue(n, "content"))
+	if name == "description" {
+		if m := meta(); m.Description == "" {
+			m.Description = content
+		}
+		return
+	}
+	// both protocols are commonly found using either name or property
+	if property == "" {
+		property = name
+	}
+	switch {
+	case strings.HasPrefix(property, "og:"):
+		meta().OpenGraph = append(meta().OpenGraph, MetaProperty{Property: property, Content: content})
+	case strings.HasPrefix(property, "twitter:"):
+		meta().Twitter = append(meta().Twitter, MetaProperty{Property: property, Content: content})
+	}
+}
+
+func extractMetaLink(base *url.URL, n *html.Node, meta func() *Meta) {
+	href := strings.TrimSpace(attrValue(n, "href"))
+	if href == "" {
+		return
+	}
+	v, err := url.Parse(href)
+	if err != nil {
+		return
+	}
+	u := base.ResolveReference(v).String()
+	for _, rel := range strings.Fields(strings.ToLower(attrValue(n, "rel"))) {
+		switch rel {
+		case "canonical":
+			if m := meta(); m.Canonical == "" {
+				m.Canonical = u
+			}
+		case "alternate":
+			meta().Alternates = append(meta().Alternates, Alternate{
+				URL:      u,
+				Hreflang: strings.TrimSpace(attrValue(n, "hreflang")),
+				Type:     strings.TrimSpace(attrValue(n, "type")),
+				Media:    strings.TrimSpace(attrValue(n, "media")),
+			})
+		}
+	}
+}
+
+// attrValue returns the value of the attribute with the given key, or an
+// empty string when the node does not have it
+func attrValue(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
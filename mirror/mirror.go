@@ -0,0 +1,317 @@
+// Package mirror saves the pages and assets of a crawl to a directory,
+// making a copy of the site that can be browsed offline.
+//
+// Each response is saved to a path mapped from its URL, and the links and
+// assets of the HTML pages and stylesheets saved are rewritten to point to
+// the local copies once the crawl finishes. The crawl needs crawler.WithKeepBody for the
+// bodies to be saved and crawler.WithFetchAssets with DownloadAssets for the
+// assets to be fetched:
+//
+//	m, err := mirror.New("site")
+//	...
+//	cr, err := crawler.New(crawler.WithFetchAssets(crawler.DownloadAssets), crawler.WithKeepBody())
+//	...
+//	err = cr.Crawl(startURL, m.CrawlFunc(fn))
+//	...
+//	err = m.Close()
+package mirror
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ernesto-jimenez/crawler"
+	"github.com/pkg/errors"
+)
+
+// ErrNoBody is returned when saving a response without its body, which
+// happens when the crawl does not use crawler.WithKeepBody
+var ErrNoBody = errors.New("response without body, crawl using crawler.WithKeepBody")
+
+// maxRedirects is the amount of redirects followed when looking up the local
+// copy of a URL
+const maxRedirects = 10
+
+// maxQueryLen is the length over which query strings are replaced by their
+// hash in file names
+const maxQueryLen = 40
+
+// Mirror saves responses to a directory. It is safe for concurrent use.
+type Mirror struct {
+	dir string
+
+	mut sync.Mutex
+	// files has the path of the file saved for each URL
+	files map[string]string
+	// dirs has the local path of each directory from the URLs
+	dirs map[string]string
+	// taken has the local paths used by files and directories
+	taken map[string]bool
+	// redirects has the target of each redirect found
+	redirects map[string]string
+	// pages are the HTML pages saved, rewritten when closing the mirror
+	pages []page
+	// stylesheets are the CSS files saved, rewritten when closing the mirror
+	stylesheets []page
+}
+
+type page struct {
+	url  *url.URL
+	path string
+}
+
+// New creates a mirror saving the files in dir, which is created if needed
+func New(dir string) (*Mirror, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Mirror{
+		dir:       dir,
+		files:     make(map[string]string),
+		dirs:      make(map[string]string),
+		taken:     make(map[string]bool),
+		redirects: make(map[string]string),
+	}, nil
+}
+
+// CrawlFunc wraps fn saving every successful response before calling fn
+func (m *Mirror) CrawlFunc(fn crawler.CrawlFunc) crawler.CrawlFunc {
+	return func(url string, res *crawler.Response, err error) error {
+		if err == nil && res != nil {
+			if err := m.Save(res); err != nil {
+				return err
+			}
+		}
+		return fn(url, res, err)
+	}
+}
+
+// Save writes the body of the response to its local path. Redirects are
+// recorded so links to them point to the local copy of their target.
+func (m *Mirror) Save(res *crawler.Response) error {
+	u, err := url.Parse(res.URL)
+	if err != nil {
+		return err
+	}
+	if res.RedirectTo != "" {
+		target, err := url.Parse(res.RedirectTo)
+		if err != nil {
+			return err
+		}
+		m.mut.Lock()
+		m.redirects[key(u)] = key(target)
+		m.mut.Unlock()
+		return nil
+	}
+	if res.Body == nil {
+		return ErrNoBody
+	}
+
+	mt := mediaType(res.ContentType)
+	m.mut.Lock()
+	local := m.allocate(u, mt)
+	switch mt {
+	case "text/html", "application/xhtml+xml":
+		m.pages = append(m.pages, page{url: u, path: local})
+	case "text/css":
+		m.stylesheets = append(m.stylesheets, page{url: u, path: local})
+	}
+	m.mut.Unlock()
+
+	body, err := res.Body.Open()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return writeFile(filepath.Join(m.dir, filepath.FromSlash(local)), body)
+}
+
+// Path returns the path of the file saved for the URL, relative to the
+// directory of the mirror, following the redirects recorded
+func (m *Mirror) Path(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", false
+	}
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	local, ok := m.lookup(u)
+	return filepath.FromSlash(local), ok
+}
+
+// Close rewrites the links and assets of the pages and stylesheets saved to
+// point to their local copies, and to the absolute URL when they were not
+// saved. It must be called once the crawl finishes.
+func (m *Mirror) Close() error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	for _, p := range m.pages {
+		if err := m.rewrite(p); err != nil {
+			return errors.Wrapf(err, "rewriting %s", p.url)
+		}
+	}
+	m.pages = nil
+	for _, p := range m.stylesheets {
+		if err := m.rewriteStylesheet(p); err != nil {
+			return errors.Wrapf(err, "rewriting %s", p.url)
+		}
+	}
+	m.stylesheets = nil
+	return nil
+}
+
+// lookup returns the local path of the URL. It must be called with the mutex
+// held.
+func (m *Mirror) lookup(u *url.URL) (string, bool) {
+	k := key(u)
+	for i := 0; i < maxRedirects; i++ {
+		target, ok := m.redirects[k]
+		if !ok {
+			break
+		}
+		k = target
+	}
+	local, ok := m.files[k]
+	return local, ok
+}
+
+// allocate returns the local path for the URL, relative to the directory of
+// the mirror. Paths are made unique when different URLs map to the same path,
+// such as /page and /page.html, or when a file and a directory would share a
+// name. It must be called with the mutex held.
+func (m *Mirror) allocate(u *url.URL, mediaType string) string {
+	k := key(u)
+	if local, ok := m.files[k]; ok {
+		return local
+	}
+
+	segments := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+	dirs := append([]string{u.Host}, segments[:len(segments)-1]...)
+	var dir, logical string
+	for _, seg := range dirs {
+		logical += "/" + seg
+		if actual, ok := m.dirs[logical]; ok {
+			dir = actual
+			continue
+		}
+		dir = m.unique(path.Join(dir, sanitize(seg)))
+		m.dirs[logical] = dir
+		m.taken[dir] = true
+	}
+
+	local := m.unique(path.Join(dir, fileName(segments[len(segments)-1], u.RawQuery, mediaType)))
+	m.files[k] = local
+	m.taken[local] = true
+	return local
+}
+
+// unique returns p, or p with a numeric suffix if it was already taken
+func (m *Mirror) unique(p string) string {
+	if !m.taken[p] {
+		return p
+	}
+	ext := path.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+		if !m.taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// fileName returns the name of the file for the last segment of a URL path.
+// Directory indexes are saved as index.html, HTML pages always have an HTML
+// extension so browsers open them, and other files without extension get the
+// extension of their media type. The query string is added to the name
+// after an @.
+func fileName(name, query, mediaType string) string {
+	if name == "" {
+		name = "index"
+	}
+	name = sanitize(name)
+	ext := path.Ext(name)
+	switch {
+	case mediaType == "text/html":
+		if ext != ".html" && ext != ".htm" {
+			ext = ".html"
+			name += ext
+		}
+	case mediaType == "application/xhtml+xml":
+		if ext != ".xhtml" && ext != ".html" && ext != ".htm" {
+			ext = ".xhtml"
+			name += ext
+		}
+	case ext == "":
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			ext = exts[0]
+			name += ext
+		}
+	}
+	if query != "" {
+		q := sanitize(query)
+		if len(q) > maxQueryLen {
+			q = fmt.Sprintf("%x", sha1.Sum([]byte(query)))[:12]
+		}
+		name = strings.TrimSuffix(name, ext) + "@" + q + ext
+	}
+	return name
+}
+
+// sanitize replaces the characters not allowed in file names on the usual
+// file systems
+func sanitize(seg string) string {
+	if seg == "" || seg == "." || seg == ".." {
+		return "_" + seg
+	}
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, seg)
+}
+
+// key normalises the URL the same way crawler.NewRequest does
+func key(u *url.URL) string {
+	v := *u
+	v.Fragment = ""
+	v.RawFragment = ""
+	if v.Path == "" {
+		v.Path = "/"
+		v.RawPath = ""
+	}
+	return v.String()
+}
+
+// mediaType returns the media type from a Content-Type header
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return mt
+}
+
+func writeFile(name string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
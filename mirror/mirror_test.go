@@ -0,0 +1,146 @@
+package mirror
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ernesto-jimenez/crawler"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirror(t *testing.T) {
+	r := require.New(t)
+
+	mux := http.NewServeMux()
+	html := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(body))
+		}
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			http.NotFound(w, req)
+			return
+		}
+		html(`<html><head><link rel="stylesheet" href="/style.css"><link rel="stylesheet" href="/css/site.css">
+<style>@import "/css/print.css"; h1 { background: url('/img/h1.png') }</style></head><body style="background: url(/img/body.png)">
+<a href="/about">about</a>
+<a href="about/#team">team</a>
+<a href="/search?q=go">search</a>
+<a href="/old">old</a>
+<a href="/missing">missing</a>
+<a href="#top">top</a>
+<a href="mailto:someone@example.com">mail</a>
+<img src="img/logo.png" srcset="img/logo.png 1x, img/logo@2x.png 2x" alt="">
+</body></html>`)(w, req)
+	})
+	mux.HandleFunc("/about", html(`<a href="/">home</a>`))
+	mux.HandleFunc("/about/", html(`<base href="/"><a href="about">about</a><img src="img/logo.png">`))
+	mux.HandleFunc("/search", html(`<a href="?q=go">again</a>`))
+	mux.HandleFunc("/old", func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "/about", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/style.css", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Write([]byte(`body { background: url(img/bg.png) }`))
+	})
+	mux.HandleFunc("/css/site.css", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Write([]byte(`body { background: url(/img/bg.png) } p { background: url("../missing.png") }`))
+	})
+	mux.HandleFunc("/css/print.css", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Write([]byte(`@import url(site.css);`))
+	})
+	mux.HandleFunc("/img/", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	host := filepath.Base(ts.URL[len("http://"):])
+
+	dir, err := ioutil.TempDir("", "mirror")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	m, err := New(dir)
+	r.NoError(err)
+	cr, err := crawler.New(crawler.WithFetchAssets(crawler.DownloadAssets), crawler.WithKeepBody())
+	r.NoError(err)
+	err = cr.Crawl(ts.URL+"/", m.CrawlFunc(func(url string, res *crawler.Response, err error) error {
+		return nil
+	}))
+	r.NoError(err)
+	r.NoError(m.Close())
+
+	site := filepath.Join(dir, sanitize(host))
+	read := func(name string) string {
+		b, err := ioutil.ReadFile(filepath.Join(site, filepath.FromSlash(name)))
+		r.NoError(err)
+		return string(b)
+	}
+	r.Equal(`<html><head><link rel="stylesheet" href="style.css"><link rel="stylesheet" href="css/site.css">
+<style>@import "css/print.css"; h1 { background: url("img/h1.png") }</style></head><body style="background: url(&#34;img/body.png&#34;)">
+<a href="about.html">about</a>
+<a href="about/index.html#team">team</a>
+<a href="search@q=go.html">search</a>
+<a href="about.html">old</a>
+<a href="`+ts.URL+`/missing">missing</a>
+<a href="#top">top</a>
+<a href="mailto:someone@example.com">mail</a>
+<img src="img/logo.png" srcset="img/logo.png 1x, img/logo@2x.png 2x" alt="">
+</body></html>`, read("index.html"))
+	r.Equal(`<a href="../about.html">about</a><img src="../img/logo.png">`, read("about/index.html"))
+	r.Equal(`<a href="index.html">home</a>`, read("about.html"))
+	r.Equal(`<a href="search@q=go.html">again</a>`, read("search@q=go.html"))
+	r.Equal(`body { background: url(img/bg.png) }`, read("style.css"))
+	// stylesheets point to the local copies too
+	r.Equal(`body { background: url("../img/bg.png") } p { background: url("`+ts.URL+`/missing.png") }`, read("css/site.css"))
+	r.Equal(`@import url(site.css);`, read("css/print.css"))
+	r.Equal("png", read("img/h1.png"))
+	r.Equal("png", read("img/body.png"))
+	r.Equal("png", read("img/bg.png"))
+	r.Equal("png", read("img/logo@2x.png"))
+
+	local, ok := m.Path(ts.URL + "/old")
+	r.True(ok)
+	r.Equal(filepath.Join(sanitize(host), "about.html"), local)
+}
+
+func TestAllocate(t *testing.T) {
+	r := require.New(t)
+
+	m, err := New(os.TempDir())
+	r.NoError(err)
+	for _, tt := range []struct {
+		url       string
+		mediaType string
+		expected  string
+	}{
+		{"http://example.com", "text/html", "example.com/index.html"},
+		{"http://example.com/", "text/html", "example.com/index.html"},
+		{"http://example.com/index.html", "text/html", "example.com/index-1.html"},
+		{"http://example.com/page", "text/html", "example.com/page.html"},
+		{"http://example.com/page.html", "text/html", "example.com/page-1.html"},
+		{"http://example.com/page.php?id=1&x=a/b", "text/html", "example.com/page.php@id=1&x=a_b.html"},
+		{"http://example.com/?q=" + strings.Repeat("a", 50), "text/html", "example.com/index@f65ae2567e26.html"},
+		{"http://example.com/style", "text/css", "example.com/style.css"},
+		{"http://example.com/data", "", "example.com/data"},
+		{"http://example.com/data/item", "", "example.com/data-1/item"},
+		{"http://example.com/data/other", "", "example.com/data-1/other"},
+		{"http://example.com:8080/a%3Fb/..", "", "example.com_8080/a_b/_.."},
+		{"http://example.com/#fragment", "text/html", "example.com/index.html"},
+	} {
+		u, err := url.Parse(tt.url)
+		r.NoError(err)
+		r.Equal(tt.expected, m.allocate(u, tt.mediaType), tt.url)
+	}
+}
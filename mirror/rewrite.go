@@ -0,0 +1,165 @@
+package mirror
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ernesto-jimenez/crawler"
+	"golang.org/x/net/html"
+)
+
+// rewrite updates the links and assets of a saved page to point to the local
+// copies. Tags and attributes that need no changes are kept as they were.
+// It must be called with the mutex held.
+func (m *Mirror) rewrite(p page) error {
+	name := filepath.Join(m.dir, filepath.FromSlash(p.path))
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	base := p.url
+	var (
+		out   bytes.Buffer
+		style bool
+	)
+	z := html.NewTokenizer(bytes.NewReader(src))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return z.Err()
+			}
+			break
+		}
+		// the tokenizer lowercases the raw bytes when reading the tag
+		raw := append([]byte(nil), z.Raw()...)
+		if tt == html.TextToken && style {
+			out.WriteString(m.rewriteCSS(base, p.path, string(raw)))
+			continue
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			style = false
+			out.Write(raw)
+			continue
+		}
+		tok := z.Token()
+		style = tok.Data == "style" && tt == html.StartTagToken
+		if tok.Data == "base" {
+			// links are relative to the local file instead
+			if href, ok := attr(tok, "href"); ok {
+				if v, err := url.Parse(strings.TrimSpace(href)); err == nil {
+					base = base.ResolveReference(v)
+				}
+			}
+			continue
+		}
+		var changed bool
+		for i, a := range tok.Attr {
+			var v string
+			switch {
+			case a.Key == "href" || a.Key == "src" || a.Key == "poster" || a.Key == "xlink:href" ||
+				(a.Key == "data" && tok.Data == "object"):
+				v = m.rewriteURL(base, p.path, a.Val)
+			case a.Key == "srcset":
+				v = m.rewriteSrcset(base, p.path, a.Val)
+			case a.Key == "style":
+				v = m.rewriteCSS(base, p.path, a.Val)
+			default:
+				continue
+			}
+			if v != a.Val {
+				tok.Attr[i].Val = v
+				changed = true
+			}
+		}
+		if changed {
+			out.WriteString(tok.String())
+		} else {
+			out.Write(raw)
+		}
+	}
+	return ioutil.WriteFile(name, out.Bytes(), 0644)
+}
+
+// rewriteURL returns the path to the local copy of ref relative to the page
+// saved in from, or the absolute URL when there is no local copy. References
+// within the page and to other schemes are kept.
+func (m *Mirror) rewriteURL(base *url.URL, from, ref string) string {
+	v, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || (v.Scheme == "" && v.Host == "" && v.Path == "" && v.RawQuery == "") {
+		return ref
+	}
+	abs := base.ResolveReference(v)
+	if abs.Scheme != "http" && abs.Scheme != "https" {
+		return ref
+	}
+	local, ok := m.lookup(abs)
+	if !ok {
+		return abs.String()
+	}
+	rel := &url.URL{Path: relativePath(from, local), Fragment: abs.Fragment}
+	return rel.String()
+}
+
+// rewriteSrcset rewrites every URL of a srcset attribute, keeping their
+// descriptors
+func (m *Mirror) rewriteSrcset(base *url.URL, from, srcset string) string {
+	var candidates []string
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = m.rewriteURL(base, from, fields[0])
+		candidates = append(candidates, strings.Join(fields, " "))
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// rewriteCSS rewrites the references of the url() and @import of the CSS
+func (m *Mirror) rewriteCSS(base *url.URL, from, css string) string {
+	return crawler.RewriteCSS(css, func(ref string) string {
+		return m.rewriteURL(base, from, ref)
+	})
+}
+
+// rewriteStylesheet updates the references of a saved stylesheet to point to
+// the local copies. It must be called with the mutex held.
+func (m *Mirror) rewriteStylesheet(p page) error {
+	name := filepath.Join(m.dir, filepath.FromSlash(p.path))
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	css := m.rewriteCSS(p.url, p.path, string(src))
+	if css == string(src) {
+		return nil
+	}
+	return ioutil.WriteFile(name, []byte(css), 0644)
+}
+
+// relativePath returns the path to the file to relative to the directory of
+// the file from. Both paths are slash separated.
+func relativePath(from, to string) string {
+	fromDirs := strings.Split(path.Dir(from), "/")
+	toParts := strings.Split(to, "/")
+	i := 0
+	for i < len(fromDirs) && i < len(toParts)-1 && fromDirs[i] == toParts[i] {
+		i++
+	}
+	return strings.Repeat("../", len(fromDirs)-i) + strings.Join(toParts[i:], "/")
+}
+
+func attr(tok html.Token, key string) (string, bool) {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -1,9 +1,11 @@
 package crawler
 
 import (
+	"mime"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -16,6 +18,30 @@ type options struct {
 	transport  http.RoundTripper
 	checkFetch []CheckFetchFunc
 	goroutines int
+	robotsTxt  string
+	hostRate   float64
+	hostBurst  int
+
+	retryPolicy *RetryPolicy
+	maxRedirs   *int
+	sitemaps    bool
+	directives  bool
+	extractors  []Extractor
+	parsers     map[string]ParseFunc
+	maxBodySize int64
+	keepBody    bool
+	assets      AssetPolicy
+
+	// assetCheckFetch has the checks from checkFetch that apply to assets
+	// too
+	assetCheckFetch []CheckFetchFunc
+
+	// countPage is called with the result of every page, but not asset,
+	// before reporting it to the CrawlFunc
+	countPage func(err error)
+
+	checkpointDir      string
+	checkpointInterval time.Duration
 }
 
 // WithConcurrentRequests sets how many concurrent requests to allow
@@ -29,6 +55,106 @@ func WithConcurrentRequests(n int) Option {
 	}
 }
 
+// WithRobotsTxt makes the crawler fetch the robots.txt of every host and skip
+// the URLs disallowed for the given user agent. Skipped URLs are reported to
+// the CrawlFunc with a *DisallowedError wrapping ErrDisallowedByRobots.
+//
+// The Crawl-delay for the user agent is honoured between requests to the
+// same host, and the user agent is sent in the User-Agent header of every
+// request.
+func WithRobotsTxt(userAgent string) Option {
+	return func(opts *options) error {
+		if strings.TrimSpace(userAgent) == "" {
+			return errors.New("user agent for robots.txt cannot be empty")
+		}
+		opts.robotsTxt = userAgent
+		return nil
+	}
+}
+
+// WithHostRateLimit limits the requests sent to each host to rps requests per
+// second, allowing bursts of up to burst requests. Workers wait until the
+// host allows a new request before fetching it.
+//
+// When used along WithRobotsTxt, the Crawl-delay from robots.txt is applied
+// instead whenever it is slower than the given rate.
+func WithHostRateLimit(rps float64, burst int) Option {
+	return func(opts *options) error {
+		if rps <= 0 {
+			return errors.Errorf("requests per second must be positive. was: %v", rps)
+		}
+		if burst <= 0 {
+			return errors.Errorf("burst must be a positive integer. was: %d", burst)
+		}
+		opts.hostRate = rps
+		opts.hostBurst = burst
+		return nil
+	}
+}
+
+// WithCheckpoint makes Simple keep the state of the crawl in dir so it can be
+// continued with Simple.Resume after the process stops. The counters of the
+// crawl are saved every interval, or every 30 seconds when interval is zero.
+func WithCheckpoint(dir string, interval time.Duration) Option {
+	return func(opts *options) error {
+		if dir == "" {
+			return errors.New("checkpoint directory cannot be empty")
+		}
+		if interval < 0 {
+			return errors.Errorf("checkpoint interval cannot be negative. was: %s", interval)
+		}
+		opts.checkpointDir = dir
+		opts.checkpointInterval = interval
+		return nil
+	}
+}
+
+// WithRetryPolicy retries the fetches failing with network errors, 429 or 5xx
+// responses. Failed requests are queued again after an exponential backoff
+// with jitter, or after the time specified by the Retry-After header when it
+// is longer.
+//
+// URLs failing after being retried are reported to the CrawlFunc with a
+// *RetryError.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(opts *options) error {
+		if p.MaxAttempts <= 0 {
+			return errors.Errorf("max attempts must be a positive integer. was: %d", p.MaxAttempts)
+		}
+		if p.BaseDelay <= 0 {
+			return errors.Errorf("base delay must be positive. was: %s", p.BaseDelay)
+		}
+		opts.retryPolicy = &p
+		return nil
+	}
+}
+
+// WithSitemaps makes the crawler read the sitemaps of every host it visits,
+// found in the Sitemap lines from robots.txt and at /sitemap.xml, queueing
+// the listed URLs as start URLs. Sitemaps are fetched following robots.txt
+// and the host rate limits like any other URL.
+//
+// Responses for the listed URLs have their sitemap entry in
+// Response.Sitemap, except for URLs already queued from links before the
+// sitemap of their host was read.
+func WithSitemaps() Option {
+	return func(opts *options) error {
+		opts.sitemaps = true
+		return nil
+	}
+}
+
+// WithRobotsDirectives makes the crawler honour the nofollow directives from
+// the robots meta tag, the X-Robots-Tag header and rel="nofollow" links,
+// skipping the links that should not be followed. Pages asking not to be
+// indexed are flagged in Response.Robots.
+func WithRobotsDirectives() Option {
+	return func(opts *options) error {
+		opts.directives = true
+		return nil
+	}
+}
+
 // WithHTTPTransport sets the optional http client
 func WithHTTPTransport(rt http.RoundTripper) Option {
 	return func(opts *options) error {
@@ -43,24 +169,56 @@ func WithMaxDepth(depth int) Option {
 	if depth <= 0 {
 		panic("depth should always be greater or than zero")
 	}
-	return WithCheckFetch(func(req *Request) bool {
+	return withPageCheckFetch(func(req *Request) bool {
 		return req.depth <= depth
 	})
 }
 
-// WithCheckFetch takes CheckFetchFunc that will be run before fetching each page to check whether it should be fetched or not
+// WithMaxRedirects sets how many consecutive redirects are followed from a
+// URL. Redirects over the limit are reported to the CrawlFunc with a
+// *RedirectError wrapping ErrTooManyRedirects. The default is 10.
+func WithMaxRedirects(n int) Option {
+	return func(opts *options) error {
+		if n < 0 {
+			return errors.Errorf("max redirects cannot be negative. was: %d", n)
+		}
+		opts.maxRedirs = &n
+		return nil
+	}
+}
+
+// WithCheckFetch takes CheckFetchFunc that will be run before fetching each page to check whether it should be fetched or not.
+// It is run before fetching each asset too when using WithFetchAssets.
 func WithCheckFetch(fn CheckFetchFunc) Option {
+	return func(opts *options) error {
+		opts.checkFetch = append(opts.checkFetch, fn)
+		opts.assetCheckFetch = append(opts.assetCheckFetch, fn)
+		return nil
+	}
+}
+
+// withPageCheckFetch adds a check that only applies to pages, so assets
+// are fetched regardless of it
+func withPageCheckFetch(fn CheckFetchFunc) Option {
 	return func(opts *options) error {
 		opts.checkFetch = append(opts.checkFetch, fn)
 		return nil
 	}
 }
 
+// withPageCounter calls fn with the result of every page crawled
+func withPageCounter(fn func(err error)) Option {
+	return func(opts *options) error {
+		opts.countPage = fn
+		return nil
+	}
+}
+
 // WithOneRequestPerURL adds a check to only allow URLs once
 func WithOneRequestPerURL() Option {
 	var mut sync.Mutex
 	v := make(map[string]struct{})
-	return WithCheckFetch(func(req *Request) bool {
+	return withPageCheckFetch(func(req *Request) bool {
 		mut.Lock()
 		defer mut.Unlock()
 		_, ok := v[req.URL.String()]
@@ -97,3 +255,98 @@ func WithExcludedHosts(hosts ...string) Option {
 		return !ok
 	})
 }
+
+// WithExtractor adds an Extractor to run on every HTML page crawled. Extractors
+// run in the order they were added, after the links and assets of the page
+// have been read.
+func WithExtractor(e Extractor) Option {
+	return func(opts *options) error {
+		if e == nil {
+			return errors.New("extractor cannot be nil")
+		}
+		opts.extractors = append(opts.extractors, e)
+		return nil
+	}
+}
+
+// WithSelectors stores in Response.Selected the values matched in every HTML
+// page by the given selectors, keyed by name.
+//
+// Selectors are CSS selectors matching the text of the elements, or the value
+// of an attribute when the selector ends with @attribute. e.g: "a.next@href".
+// Selectors prefixed with "xpath:" are XPath expressions instead. e.g:
+// "xpath://meta[@name='author']/@content".
+func WithSelectors(selectors map[string]string) Option {
+	return func(opts *options) error {
+		compiled, err := compileSelectors(selectors)
+		if err != nil {
+			return err
+		}
+		if len(compiled) > 0 {
+			opts.extractors = append(opts.extractors, selectorExtractor(compiled))
+		}
+		return nil
+	}
+}
+
+// WithParser sets the ParseFunc used to read the responses with the given
+// media type. e.g: application/json. It replaces the built-in parser for the
+// media type, if any, and a nil ParseFunc stops parsing the media type.
+//
+// Built-in parsers read HTML, XHTML, CSS, RSS and Atom feeds. The media type
+// is detected from the body when the Content-Type header is missing.
+func WithParser(mediaType string, parse ParseFunc) Option {
+	return func(opts *options) error {
+		mt, _, err := mime.ParseMediaType(mediaType)
+		if err != nil {
+			return errors.Wrapf(err, "invalid media type %q", mediaType)
+		}
+		if opts.parsers == nil {
+			opts.parsers = make(map[string]ParseFunc)
+		}
+		opts.parsers[mt] = parse
+		return nil
+	}
+}
+
+// WithMaxBodySize limits the bytes read from the body of each response to n.
+// Bigger responses are parsed up to the limit and flagged with
+// Response.Truncated.
+func WithMaxBodySize(n int64) Option {
+	return func(opts *options) error {
+		if n <= 0 {
+			return errors.Errorf("max body size must be positive. was: %d", n)
+		}
+		opts.maxBodySize = n
+		return nil
+	}
+}
+
+// WithFetchAssets fetches the assets of the pages crawled following the
+// policy. Each asset is fetched once before calling the CrawlFunc for the
+// page referencing it, which gets the status and size of every asset in
+// Response.Assets. Assets are reported to the CrawlFunc as well, with
+// Response.Asset set, and their links are never followed.
+//
+// Assets are fetched regardless of WithMaxDepth, but the host options and
+// the checks from WithCheckFetch apply to them. Assets skipped by those
+// checks are not reported to the CrawlFunc and have no status.
+func WithFetchAssets(policy AssetPolicy) Option {
+	return func(opts *options) error {
+		if policy != CheckAssets && policy != DownloadAssets {
+			return errors.Errorf("invalid asset policy %d", policy)
+		}
+		opts.assets = policy
+		return nil
+	}
+}
+
+// WithKeepBody keeps the body of successful responses in Response.Body for
+// the CrawlFunc to archive or hash it. Bodies are available until the
+// CrawlFunc returns, and are truncated when using WithMaxBodySize.
+func WithKeepBody() Option {
+	return func(opts *options) error {
+		opts.keepBody = true
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ParseFunc reads the links and assets from the body of a response and fills
+// them in the response. ReadResponse, ReadStylesheet and ReadFeed are
+// ParseFuncs.
+type ParseFunc func(base *url.URL, r io.Reader, res *Response) error
+
+// defaultParsers are the parsers used for each media type unless replaced
+// with WithParser
+var defaultParsers = map[string]ParseFunc{
+	"text/html":             readHTML,
+	"application/xhtml+xml": readHTML,
+	"text/css":              ReadStylesheet,
+	"application/rss+xml":   ReadFeed,
+	"application/atom+xml":  ReadFeed,
+	"application/rdf+xml":   ReadFeed,
+	"application/xml":       readXML,
+	"text/xml":              readXML,
+}
+
+// sniffLen is the amount of bytes used to detect the media type of a body
+const sniffLen = 512
+
+// mediaType returns the media type of a response from its Content-Type,
+// detecting it from the body when the header is missing or is the generic
+// application/octet-stream
+func mediaType(contentType string, body *bufio.Reader) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// be lenient with invalid parameters
+		mt = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	if mt != "" && mt != "application/octet-stream" {
+		return mt
+	}
+	head, _ := body.Peek(sniffLen)
+	return sniffMediaType(head)
+}
+
+// sniffMediaType detects the media type of a body using the algorithm from
+// http.DetectContentType, also detecting XML documents without the XML
+// declaration such as most RSS feeds
+func sniffMediaType(head []byte) string {
+	mt, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if mt == "text/plain" && bytes.HasPrefix(bytes.TrimSpace(bytes.TrimPrefix(head, utf8BOM)), []byte("<")) {
+		return "text/xml"
+	}
+	return mt
+}
+
+// resetParsed clears the fields of the response filled by the parsers
+func resetParsed(base *url.URL, res *Response) {
+	res.URL = base.String()
+	res.RedirectTo = ""
+	res.Links = nil
+	res.Assets = nil
+	res.Robots = nil
+	res.Meta = nil
+	res.StructuredData = nil
+	res.Charset = ""
+}
@@ -0,0 +1,111 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffMediaType(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{body: "<!DOCTYPE html><html></html>", expected: "text/html"},
+		{body: `<?xml version="1.0"?><feed></feed>`, expected: "text/xml"},
+		{body: `<rss version="2.0"></rss>`, expected: "text/xml"},
+		{body: "\xef\xbb\xbf  <rss></rss>", expected: "text/xml"},
+		{body: "plain text", expected: "text/plain"},
+		{body: "\x89PNG\x0d\x0a\x1a\x0a", expected: "image/png"},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			require.Equal(t, test.expected, sniffMediaType([]byte(test.body)))
+		})
+	}
+}
+
+func TestFetchParsers(t *testing.T) {
+	r := require.New(t)
+
+	bodies := map[string]struct {
+		contentType string
+		body        string
+	}{
+		"/feed":  {body: `<rss><channel><item><link>/post</link></item></channel></rss>`},
+		"/atom":  {contentType: "application/atom+xml", body: `<feed xmlns="http://www.w3.org/2005/Atom"><entry><link href="/entry"/></entry></feed>`},
+		"/xhtml": {contentType: "application/xhtml+xml", body: `<html xmlns="http://www.w3.org/1999/xhtml"><body><a href="/from-xhtml">x</a></body></html>`},
+		"/bin":   {contentType: "application/octet-stream", body: `<html><body><a href="/from-bin">x</a></body></html>`},
+		"/json":  {contentType: "application/json", body: `{"links": ["/from-json"]}`},
+		"/plain": {contentType: "text/plain", body: `<a href="/ignored">plain</a>`},
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, ok := bodies[r.URL.Path]
+		if !ok {
+			w.Header().Set("Content-Type", "text/html")
+			return
+		}
+		// a nil Content-Type stops net/http from setting one
+		w.Header()["Content-Type"] = nil
+		if b.contentType != "" {
+			w.Header().Set("Content-Type", b.contentType)
+		}
+		io.WriteString(w, b.body)
+	}))
+	defer s.Close()
+
+	jsonParser := func(base *url.URL, r io.Reader, res *Response) error {
+		var doc struct{ Links []string }
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return err
+		}
+		for _, l := range doc.Links {
+			res.Links = append(res.Links, Link{URL: linkURL(base, l)})
+		}
+		return nil
+	}
+
+	c, err := New(WithMaxDepth(1), WithParser("application/json; charset=utf-8", jsonParser))
+	r.NoError(err)
+
+	links := make(map[string][]Link)
+	err = c.Crawl(s.URL+"/feed", func(url string, res *Response, err error) error {
+		r.NoError(err)
+		links[url] = res.Links
+		return nil
+	})
+	r.NoError(err)
+	r.Equal([]Link{{URL: s.URL + "/post"}}, links[s.URL+"/feed"])
+
+	for path, expected := range map[string][]Link{
+		"/atom":  {{URL: s.URL + "/entry"}},
+		"/xhtml": {{URL: s.URL + "/from-xhtml", Text: "x", Line: 1, Column: 50}},
+		"/bin":   {{URL: s.URL + "/from-bin", Text: "x", Line: 1, Column: 13}},
+		"/json":  {{URL: s.URL + "/from-json"}},
+		"/plain": nil,
+	} {
+		links := make(map[string][]Link)
+		err = c.Crawl(s.URL+path, func(url string, res *Response, err error) error {
+			r.NoError(err)
+			links[url] = res.Links
+			return ErrSkipURL
+		})
+		r.NoError(err)
+		r.Equal(expected, links[s.URL+path], path)
+	}
+}
+
+func TestWithParserInvalidMediaType(t *testing.T) {
+	_, err := New(WithParser("", ReadResponse))
+	require.Error(t, err)
+}
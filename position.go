@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// sourcePositions finds where elements start in the source of a document.
+// html.Parse does not keep positions, so the start tags are found with a
+// separate tokenizer pass and matched in order with the parsed elements.
+// Elements cloned by the parser when fixing misnested tags get the position
+// of the element they were cloned from.
+type sourcePositions struct {
+	src        []byte
+	lineStarts []int
+	nodes      map[*html.Node]int
+}
+
+type tagPosition struct {
+	offset int
+	attr   []html.Attribute
+}
+
+// trackFunc reports whether the position of an element is needed
+type trackFunc func(tag string, attr []html.Attribute) bool
+
+// newSourcePositions finds the position of the elements from doc accepted by
+// track, doc being the result of parsing src
+func newSourcePositions(src []byte, doc *html.Node, track trackFunc) *sourcePositions {
+	p := &sourcePositions{
+		src:        src,
+		lineStarts: []int{0},
+		nodes:      make(map[*html.Node]int),
+	}
+	for i, b := range src {
+		if b == '\n' {
+			p.lineStarts = append(p.lineStarts, i+1)
+		}
+	}
+
+	tags := make(map[string][]tagPosition)
+	z := html.NewTokenizer(bytes.NewReader(src))
+	offset := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := len(z.Raw())
+		if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+			tok := z.Token()
+			if track(tok.Data, tok.Attr) {
+				tags[tok.Data] = append(tags[tok.Data], tagPosition{offset: offset, attr: tok.Attr})
+			}
+		}
+		offset += raw
+	}
+
+	last := make(map[string]tagPosition)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && track(n.Data, n.Attr) {
+			pending := tags[n.Data]
+			prev, hasPrev := last[n.Data]
+			switch {
+			case len(pending) > 0 && sameAttrs(pending[0].attr, n.Attr):
+				p.nodes[n] = pending[0].offset
+				last[n.Data] = pending[0]
+				tags[n.Data] = pending[1:]
+			case hasPrev && sameAttrs(prev.attr, n.Attr):
+				p.nodes[n] = prev.offset
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return p
+}
+
+// position returns the line and column, starting at one, where the element
+// starts. It returns zeros when the element is not tracked or it could not
+// be matched.
+func (p *sourcePositions) position(n *html.Node) (line, column int) {
+	offset, ok := p.nodes[n]
+	if !ok {
+		return 0, 0
+	}
+	lo, hi := 0, len(p.lineStarts)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if p.lineStarts[mid] <= offset {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo + 1, utf8.RuneCount(p.src[p.lineStarts[lo]:offset]) + 1
+}
+
+func sameAttrs(a, b []html.Attribute) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// hostLimiter throttles the requests sent to each host using a token bucket
+// per host. The crawl delay from robots.txt overrides the configured rate
+// when it is slower.
+type hostLimiter struct {
+	interval time.Duration
+	burst    int
+
+	mut   sync.Mutex
+	hosts map[string]*hostBucket
+	now   func() time.Time
+}
+
+type hostBucket struct {
+	interval time.Duration
+	burst    int
+	tokens   float64
+	last     time.Time
+}
+
+// newHostLimiter returns a limiter allowing rps requests per second to each
+// host with bursts of up to burst requests. A zero rps only applies the
+// crawl delays from robots.txt.
+func newHostLimiter(rps float64, burst int) *hostLimiter {
+	l := &hostLimiter{
+		burst: burst,
+		hosts: make(map[string]*hostBucket),
+		now:   time.Now,
+	}
+	if rps > 0 {
+		l.interval = time.Duration(float64(time.Second) / rps)
+	}
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	return l
+}
+
+// wait blocks until a request to the host is allowed or the context is done
+func (l *hostLimiter) wait(ctx context.Context, host string, crawlDelay time.Duration) error {
+	l.mut.Lock()
+	b := l.bucket(host, crawlDelay)
+	d := b.reserve(l.now())
+	l.mut.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		l.mut.Lock()
+		b.tokens++
+		l.mut.Unlock()
+		return ctx.Err()
+	}
+}
+
+// delay returns the minimum time between requests to the given host
+func (l *hostLimiter) delay(host string) time.Duration {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if b, ok := l.hosts[host]; ok {
+		return b.interval
+	}
+	return l.interval
+}
+
+func (l *hostLimiter) bucket(host string, crawlDelay time.Duration) *hostBucket {
+	b, ok := l.hosts[host]
+	if !ok {
+		b = &hostBucket{
+			interval: l.interval,
+			burst:    l.burst,
+			tokens:   float64(l.burst),
+			last:     l.now(),
+		}
+		l.hosts[host] = b
+	}
+	if crawlDelay > b.interval {
+		b.interval = crawlDelay
+		b.burst = 1
+		if b.tokens > 1 {
+			b.tokens = 1
+		}
+	}
+	return b
+}
+
+// reserve takes a token from the bucket and returns how long to wait before
+// using it
+func (b *hostBucket) reserve(now time.Time) time.Duration {
+	if b.interval <= 0 {
+		return 0
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += float64(elapsed) / float64(b.interval)
+		b.last = now
+	}
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens * float64(b.interval))
+}
@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostLimiterReserve(t *testing.T) {
+	r := require.New(t)
+
+	now := time.Unix(0, 0)
+	l := newHostLimiter(10, 2)
+	l.now = func() time.Time { return now }
+
+	b := l.bucket("a.test", 0)
+	r.Equal(time.Duration(0), b.reserve(now))
+	r.Equal(time.Duration(0), b.reserve(now))
+	r.Equal(100*time.Millisecond, b.reserve(now))
+	r.Equal(200*time.Millisecond, b.reserve(now))
+
+	now = now.Add(time.Second)
+	r.Equal(time.Duration(0), b.reserve(now))
+	r.Equal(time.Duration(0), b.reserve(now))
+	r.Equal(100*time.Millisecond, b.reserve(now))
+
+	r.Equal(100*time.Millisecond, l.delay("a.test"))
+	r.Equal(100*time.Millisecond, l.delay("unknown.test"))
+}
+
+func TestHostLimiterCrawlDelay(t *testing.T) {
+	r := require.New(t)
+
+	now := time.Unix(0, 0)
+	l := newHostLimiter(10, 5)
+	l.now = func() time.Time { return now }
+
+	b := l.bucket("slow.test", 2*time.Second)
+	r.Equal(time.Duration(0), b.reserve(now))
+	r.Equal(2*time.Second, b.reserve(now))
+	r.Equal(2*time.Second, l.delay("slow.test"))
+
+	// other hosts keep the configured rate
+	r.Equal(100*time.Millisecond, l.delay("fast.test"))
+
+	// without a rate only the crawl delay applies
+	l = newHostLimiter(0, 0)
+	r.Equal(time.Duration(0), l.bucket("a.test", 0).reserve(now))
+	r.Equal(time.Duration(0), l.bucket("a.test", 0).reserve(now))
+}
+
+func TestHostLimiterWaitCancelled(t *testing.T) {
+	r := require.New(t)
+
+	l := newHostLimiter(0.001, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.NoError(l.wait(ctx, "a.test", 0))
+	cancel()
+	r.Equal(context.Canceled, l.wait(ctx, "a.test", 0))
+}
+
+func TestCrawlWithCrawlDelay(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		mut      sync.Mutex
+		requests []time.Time
+	)
+	fs := http.FileServer(http.Dir("testdata"))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nCrawl-delay: 0.1\n"))
+			return
+		}
+		mut.Lock()
+		requests = append(requests, time.Now())
+		mut.Unlock()
+		fs.ServeHTTP(w, req)
+	}))
+	defer s.Close()
+
+	q := NewInMemoryQueue(context.Background())
+	req, err := NewRequest(s.URL + "/start-cycle.html")
+	r.NoError(err)
+	r.NoError(q.PushBack(req))
+
+	w, err := NewWorker(func(url string, res *Response, err error) error {
+		return nil
+	}, WithRobotsTxt("testbot"), WithHostRateLimit(1000, 10), WithConcurrentRequests(4), WithOneRequestPerURL())
+	r.NoError(err)
+
+	r.Equal(time.Millisecond, w.HostDelay(req.URL.Host))
+	r.NoError(w.Run(context.Background(), q))
+	r.Equal(100*time.Millisecond, w.HostDelay(req.URL.Host))
+
+	r.Len(requests, 3)
+	for i := 1; i < len(requests); i++ {
+		r.True(requests[i].Sub(requests[i-1]) >= 90*time.Millisecond, "requests were not delayed")
+	}
+}
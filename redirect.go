@@ -0,0 +1,98 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// defaultMaxRedirects is the amount of consecutive redirects followed when
+// WithMaxRedirects is not used
+const defaultMaxRedirects = 10
+
+var (
+	// ErrTooManyRedirects is wrapped by the *RedirectError passed to the
+	// CrawlFunc when a URL redirects more times than allowed
+	ErrTooManyRedirects = errors.New("too many redirects")
+
+	// ErrRedirectLoop is wrapped by the *RedirectError passed to the
+	// CrawlFunc when a URL redirects to a URL already in its redirect chain
+	ErrRedirectLoop = errors.New("redirect loop")
+)
+
+// Redirect is a single hop in a chain of redirects
+type Redirect struct {
+	// URL that responded with the redirect
+	URL string `json:"url"`
+
+	// StatusCode of the redirect response. e.g: 301
+	StatusCode int `json:"status_code"`
+
+	// MetaRefresh is set when the redirect came from a
+	// <meta http-equiv="refresh"> tag instead of the HTTP status
+	MetaRefresh bool `json:"meta_refresh,omitempty"`
+}
+
+// Permanent returns whether the redirect was permanent (301 or 308)
+func (r Redirect) Permanent() bool {
+	return r.StatusCode == http.StatusMovedPermanently || r.StatusCode == http.StatusPermanentRedirect
+}
+
+// RedirectError is passed to the CrawlFunc along with the redirect Response
+// when a redirect is not followed. It wraps either ErrTooManyRedirects or
+// ErrRedirectLoop.
+type RedirectError struct {
+	FetchError
+
+	// Chain has every redirect followed to reach the URL, including the
+	// redirect that was not followed
+	Chain []Redirect
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("%s after %d redirects for %s", e.Err, len(e.Chain), e.URL)
+}
+
+// redirectHop returns the hop in the redirect chain for a response
+// redirecting to another URL
+func redirectHop(res *Response) Redirect {
+	return Redirect{
+		URL:         res.URL,
+		StatusCode:  res.StatusCode,
+		MetaRefresh: !isRedirect(res.StatusCode),
+	}
+}
+
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// checkRedirect returns a *RedirectError when the redirect in the response
+// should not be followed
+func checkRedirect(req *Request, res *Response, maxRedirs int) error {
+	chain := append(append([]Redirect(nil), res.RedirectChain...), redirectHop(res))
+	newErr := func(err error) error {
+		return &RedirectError{
+			FetchError: FetchError{URL: req.URL.String(), Request: req, Err: err},
+			Chain:      chain,
+		}
+	}
+	next, err := NewRequest(res.RedirectTo)
+	if err != nil {
+		return err
+	}
+	for _, hop := range chain {
+		if hop.URL == next.URL.String() {
+			return newErr(ErrRedirectLoop)
+		}
+	}
+	if len(chain) > maxRedirs {
+		return newErr(ErrTooManyRedirects)
+	}
+	return nil
+}
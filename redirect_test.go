@@ -0,0 +1,140 @@
+package crawler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newRedirectServer() *httptest.Server {
+	redirects := map[string]struct {
+		to   string
+		code int
+	}{
+		"/301":    {to: "/302", code: http.StatusMovedPermanently},
+		"/302":    {to: "/303", code: http.StatusFound},
+		"/303":    {to: "/307", code: http.StatusSeeOther},
+		"/307":    {to: "/308", code: http.StatusTemporaryRedirect},
+		"/308":    {to: "/final", code: http.StatusPermanentRedirect},
+		"/loop-a": {to: "/loop-b", code: http.StatusFound},
+		"/loop-b": {to: "/loop-a", code: http.StatusFound},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if redir, ok := redirects[r.URL.Path]; ok {
+			http.Redirect(w, r, redir.to, redir.code)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("final"))
+	}))
+}
+
+func TestCrawlRedirectChain(t *testing.T) {
+	r := require.New(t)
+
+	s := newRedirectServer()
+	defer s.Close()
+
+	c, err := New()
+	r.NoError(err)
+
+	responses := make(map[string]*Response)
+	err = c.Crawl(s.URL+"/301", func(url string, res *Response, err error) error {
+		r.NoError(err)
+		responses[url] = res
+		return nil
+	})
+	r.NoError(err)
+	r.Len(responses, 6)
+
+	final := responses[s.URL+"/final"]
+	r.Equal([]Redirect{
+		{URL: s.URL + "/301", StatusCode: http.StatusMovedPermanently},
+		{URL: s.URL + "/302", StatusCode: http.StatusFound},
+		{URL: s.URL + "/303", StatusCode: http.StatusSeeOther},
+		{URL: s.URL + "/307", StatusCode: http.StatusTemporaryRedirect},
+		{URL: s.URL + "/308", StatusCode: http.StatusPermanentRedirect},
+	}, final.RedirectChain)
+	r.True(final.RedirectChain[0].Permanent())
+	r.False(final.RedirectChain[1].Permanent())
+	r.True(final.RedirectChain[4].Permanent())
+
+	r.Equal(s.URL+"/308", responses[s.URL+"/307"].RedirectTo)
+}
+
+func TestCrawlTooManyRedirects(t *testing.T) {
+	r := require.New(t)
+
+	s := newRedirectServer()
+	defer s.Close()
+
+	c, err := New(WithMaxRedirects(2))
+	r.NoError(err)
+
+	var urls []string
+	err = c.Crawl(s.URL+"/301", func(url string, res *Response, err error) error {
+		urls = append(urls, url)
+		if url != s.URL+"/303" {
+			r.NoError(err)
+			return nil
+		}
+		var redirErr *RedirectError
+		r.True(errors.As(err, &redirErr))
+		r.True(errors.Is(err, ErrTooManyRedirects))
+		r.Len(redirErr.Chain, 3)
+		r.Equal(s.URL+"/307", res.RedirectTo)
+		return nil
+	})
+	r.NoError(err)
+	r.Equal([]string{s.URL + "/301", s.URL + "/302", s.URL + "/303"}, urls)
+}
+
+func TestCrawlRedirectLoop(t *testing.T) {
+	r := require.New(t)
+
+	s := newRedirectServer()
+	defer s.Close()
+
+	c, err := New()
+	r.NoError(err)
+
+	errs := make(map[string]error)
+	err = c.Crawl(s.URL+"/loop-a", func(url string, res *Response, err error) error {
+		errs[url] = err
+		return nil
+	})
+	r.NoError(err)
+	r.Len(errs, 2)
+	r.NoError(errs[s.URL+"/loop-a"])
+	r.True(errors.Is(errs[s.URL+"/loop-b"], ErrRedirectLoop))
+}
+
+func TestCrawlMetaRefresh(t *testing.T) {
+	r := require.New(t)
+
+	s := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer s.Close()
+
+	c, err := New(WithMaxDepth(1))
+	r.NoError(err)
+
+	responses := make(map[string]*Response)
+	err = c.Crawl(s.URL+"/meta-refresh.html", func(url string, res *Response, err error) error {
+		r.NoError(err)
+		responses[url] = res
+		return nil
+	})
+	r.NoError(err)
+
+	r.Equal(s.URL+"/depth-one.html", responses[s.URL+"/meta-refresh.html"].RedirectTo)
+	r.Equal([]Redirect{
+		{URL: s.URL + "/meta-refresh.html", StatusCode: http.StatusOK, MetaRefresh: true},
+	}, responses[s.URL+"/depth-one.html"].RedirectChain)
+
+	// links in the page are followed as well
+	r.Contains(responses, s.URL+"/start-cycle.html")
+	r.Nil(responses[s.URL+"/start-cycle.html"].RedirectChain)
+}
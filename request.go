@@ -10,6 +10,10 @@ type Request struct {
 
 	depth     int
 	redirects int
+	attempts  int
+	chain     []Redirect
+	sitemap   *SitemapURL
+	page      *url.URL
 	finished  bool
 	onFinish  func()
 }
@@ -29,6 +33,19 @@ func NewRequest(uri string) (*Request, error) {
 	}, nil
 }
 
+// IsAsset returns whether the request fetches an asset of a page, as enabled
+// with WithFetchAssets, rather than a page
+func (r *Request) IsAsset() bool {
+	return r.page != nil
+}
+
+// Page returns the URL of the page where an asset was found, following the
+// assets referenced from other assets back to their page. It is nil for
+// requests that are not assets.
+func (r *Request) Page() *url.URL {
+	return r.page
+}
+
 // Finish should be called once the request has been completed
 func (r *Request) Finish() {
 	if r.onFinish != nil {
@@ -1,10 +1,17 @@
 package crawler
 
 import (
-	"golang.org/x/net/html"
+	"bytes"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
 )
 
 // Response has the details from crawling a single URL
@@ -14,13 +21,110 @@ type Response struct {
 	Links      []Link  `json:"links"`
 	Assets     []Asset `json:"assets"`
 
+	// StatusCode is the HTTP status code of the response
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Header contains the HTTP headers of the response
+	Header http.Header `json:"header,omitempty"`
+
+	// ContentType is the value of the Content-Type header
+	ContentType string `json:"content_type,omitempty"`
+
+	// Charset is the character encoding the page was decoded from. e.g: utf-8
+	Charset string `json:"charset,omitempty"`
+
+	// ContentLength is the size of the body in bytes. It is -1 when the size
+	// is unknown because the server did not send it and the body was not read
+	ContentLength int64 `json:"content_length,omitempty"`
+
+	// Truncated is set when the body was bigger than the size set with
+	// WithMaxBodySize and only the beginning of it was read
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Body is the body of the response when using WithKeepBody
+	Body *Body `json:"-"`
+
+	// Timing has the breakdown of the time spent fetching the URL
+	Timing *Timing `json:"timing,omitempty"`
+
+	// RedirectChain has the redirects followed to reach the URL
+	RedirectChain []Redirect `json:"redirect_chain,omitempty"`
+
+	// Robots has the directives from the robots meta tag and the
+	// X-Robots-Tag header, if any
+	Robots *RobotsDirectives `json:"robots,omitempty"`
+
+	// Meta has the metadata of HTML pages such as the title and headings
+	Meta *Meta `json:"meta,omitempty"`
+
+	// StructuredData has the JSON-LD, microdata and RDFa found in the page
+	StructuredData []StructuredData `json:"structured_data,omitempty"`
+
+	// Sitemap has the entry from the sitemap listing the URL when it was
+	// queued from a sitemap
+	Sitemap *SitemapURL `json:"sitemap,omitempty"`
+
+	// Attempts is the amount of times the URL was fetched to get the response
+	Attempts int `json:"attempts,omitempty"`
+
+	// Asset is set when the URL was fetched as an asset of a page with
+	// WithFetchAssets
+	Asset bool `json:"asset,omitempty"`
+
+	// Data has the values written by the extractors set with WithExtractor
+	Data map[string]interface{} `json:"data,omitempty"`
+
+	// Selected has the values matched by the selectors set with WithSelectors
+	Selected map[string][]string `json:"selected,omitempty"`
+
 	request *Request
+
+	// doc and docBase keep the parsed HTML until the extractors run
+	doc     *html.Node
+	docBase *url.URL
 }
 
 // Link contains the informaiton from a single `a` tag
 type Link struct {
 	// URL contains the href attribute of the link. e.g: <a href="{href}">...</a>
 	URL string `json:"url"`
+
+	// Rel contains the rel attribute of the link. e.g: <a rel="{rel}">...</a>
+	Rel string `json:"rel,omitempty"`
+
+	// Text is the visible anchor text with whitespace collapsed. The alt text
+	// of images inside the link is included. e.g: <a>{text}</a>
+	Text string `json:"text,omitempty"`
+
+	// Title contains the title attribute of the link. e.g: <a title="{title}">...</a>
+	Title string `json:"title,omitempty"`
+
+	// Target contains the target attribute of the link. e.g: <a target="{target}">...</a>
+	Target string `json:"target,omitempty"`
+
+	// Hreflang contains the hreflang attribute of the link. e.g: <a hreflang="{hreflang}">...</a>
+	Hreflang string `json:"hreflang,omitempty"`
+
+	// InNav is set when the link is inside a <nav> element
+	InNav bool `json:"in_nav,omitempty"`
+
+	// InFooter is set when the link is inside a <footer> element
+	InFooter bool `json:"in_footer,omitempty"`
+
+	// Line and Column are where the `a` tag starts in the document, starting
+	// at one. They are zero when the position is unknown.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// NoFollow returns whether the link is marked with rel="nofollow"
+func (l Link) NoFollow() bool {
+	for _, rel := range strings.Fields(strings.ToLower(l.Rel)) {
+		if rel == "nofollow" {
+			return true
+		}
+	}
+	return false
 }
 
 // Asset represents linked assets such as link, script and img tags
@@ -36,33 +140,202 @@ type Asset struct {
 
 	// Type contains the text of the type attribute
 	Type string `json:"type,omitempty"`
+
+	// Width is the width descriptor of the asset in a srcset. e.g: 640 for
+	// "image.png 640w"
+	Width int `json:"width,omitempty"`
+
+	// Density is the pixel density descriptor of the asset in a srcset.
+	// e.g: 1.5 for "image.png 1.5x"
+	Density float64 `json:"density,omitempty"`
+
+	// StatusCode is the HTTP status code of the asset when fetched with
+	// WithFetchAssets, after following redirects
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Size is the size in bytes of the asset when fetched with
+	// WithFetchAssets and the size is known
+	Size int64 `json:"size,omitempty"`
+
+	// Error is the reason fetching the asset failed, if it did
+	Error string `json:"error,omitempty"`
 }
 
 // ReadResponse extracts links and assets from the HTML read form the given io
-// reader and fills it in the response
+// reader and fills it in the response.
+//
+// The HTML is decoded to UTF-8 using the charset from the ContentType of the
+// response, the byte order mark or the <meta charset> tag of the document.
 func ReadResponse(base *url.URL, r io.Reader, res *Response) error {
-	res.URL = base.String()
-	res.Links = nil
-	res.Assets = nil
-	node, err := html.Parse(r)
+	err := readHTML(base, r, res)
+	res.doc, res.docBase = nil, nil
+	return err
+}
+
+// readHTML works like ReadResponse, keeping the parsed document in the
+// response for the extractors
+func readHTML(base *url.URL, r io.Reader, res *Response) error {
+	resetParsed(base, res)
+	res.doc, res.docBase = nil, nil
+	src, err := ioutil.ReadAll(r)
 	if err != nil {
 		return err
 	}
+	src, res.Charset, err = decodeHTML(src, res.ContentType)
+	if err != nil {
+		return err
+	}
+	node, err := html.Parse(bytes.NewReader(src))
+	if err != nil {
+		return err
+	}
+	base = documentBase(base, node)
+	positions := newSourcePositions(src, node, trackPosition)
 	var dfWalk func(*html.Node)
 	dfWalk = func(n *html.Node) {
+		extractStructuredData(base, n, positions, res)
+		res.Assets = append(res.Assets, extractStyleAttrAssets(base, n)...)
 		if link := extractLink(base, n); link != nil {
+			link.Line, link.Column = positions.position(n)
 			res.Links = append(res.Links, *link)
 		} else if assets := extractAssets(base, n); len(assets) > 0 {
 			res.Assets = append(res.Assets, assets...)
+		} else {
+			extractRobotsMeta(n, res)
+			extractMetaRefresh(base, n, res)
+			extractMeta(base, n, res)
 		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
 			dfWalk(c)
 		}
 	}
 	dfWalk(node)
+	res.doc, res.docBase = node, base
 	return nil
 }
 
+// decodeHTML converts the document to UTF-8, returning the name of the
+// charset it was encoded with. Documents without a declared charset are
+// read as UTF-8 when valid, instead of the windows-1252 fallback.
+func decodeHTML(src []byte, contentType string) ([]byte, string, error) {
+	e, name, certain := charset.DetermineEncoding(src, contentType)
+	if !certain && name == "windows-1252" && utf8.Valid(src) {
+		name = "utf-8"
+	}
+	if name == "utf-8" {
+		return bytes.TrimPrefix(src, utf8BOM), name, nil
+	}
+	decoded, err := e.NewDecoder().Bytes(src)
+	if err != nil {
+		return nil, name, err
+	}
+	return bytes.TrimPrefix(decoded, utf8BOM), name, nil
+}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// trackPosition selects the elements whose position in the source is
+// reported: links and structured data
+func trackPosition(tag string, attr []html.Attribute) bool {
+	return tag == "a" || isStructuredData(tag, attr)
+}
+
+// documentBase returns the URL from the first <base href> in the document
+// resolved against the URL of the response, or the URL of the response when
+// the document has none
+func documentBase(base *url.URL, doc *html.Node) *url.URL {
+	var find func(*html.Node) *url.URL
+	find = func(n *html.Node) *url.URL {
+		if n.Type == html.ElementNode && n.Data == "base" {
+			for _, attr := range n.Attr {
+				if attr.Key != "href" {
+					continue
+				}
+				v, err := url.Parse(strings.TrimSpace(attr.Val))
+				if err != nil {
+					return nil
+				}
+				return base.ResolveReference(v)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if u := find(c); u != nil {
+				return u
+			}
+		}
+		return nil
+	}
+	if u := find(doc); u != nil {
+		return u
+	}
+	return base
+}
+
+// maxMetaRefreshRedirect is the longest delay in seconds of a
+// <meta http-equiv="refresh"> taken as a redirect. Refreshes to another URL
+// after longer delays are taken as links.
+const maxMetaRefreshRedirect = 1
+
+// extractMetaRefresh sets the RedirectTo of the response from the first
+// <meta http-equiv="refresh" content="0;url=..."> pointing to another URL
+// without waiting over maxMetaRefreshRedirect, and adds slower ones to the
+// links
+func extractMetaRefresh(base *url.URL, n *html.Node, res *Response) {
+	if n.Type != html.ElementNode || n.Data != "meta" {
+		return
+	}
+	var equiv, content string
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "http-equiv":
+			equiv = strings.ToLower(strings.TrimSpace(attr.Val))
+		case "content":
+			content = attr.Val
+		}
+	}
+	if equiv != "refresh" {
+		return
+	}
+	i := strings.IndexAny(content, ";,")
+	if i < 0 {
+		return
+	}
+	delay, err := strconv.ParseFloat(strings.TrimSpace(content[:i]), 64)
+	if err != nil || delay < 0 {
+		return
+	}
+	target := strings.TrimSpace(content[i+1:])
+	if len(target) > 3 && strings.EqualFold(target[:3], "url") {
+		if rest := strings.TrimSpace(target[3:]); strings.HasPrefix(rest, "=") {
+			target = strings.TrimSpace(rest[1:])
+		}
+	}
+	target = strings.Trim(target, `'"`)
+	if target == "" {
+		return
+	}
+	v, err := url.Parse(target)
+	if err != nil {
+		return
+	}
+	if v.Scheme != "" && v.Scheme != "http" && v.Scheme != "https" {
+		return
+	}
+	v = base.ResolveReference(v)
+	v.Fragment = ""
+	// pages refreshing themselves are not redirects
+	if v.String() == res.URL {
+		return
+	}
+	if delay > maxMetaRefreshRedirect {
+		res.Links = append(res.Links, Link{URL: v.String()})
+		return
+	}
+	if res.RedirectTo == "" {
+		res.RedirectTo = v.String()
+	}
+}
+
 func extractLink(base *url.URL, n *html.Node) *Link {
 	if n.Type != html.ElementNode {
 		return nil
@@ -72,26 +345,78 @@ func extractLink(base *url.URL, n *html.Node) *Link {
 	}
 	var link Link
 	for _, attr := range n.Attr {
-		if attr.Key != "href" {
-			continue
-		}
-		v, err := url.Parse(strings.TrimSpace(attr.Val))
-		if err != nil {
-			continue
-		}
-		if v.Scheme != "" && v.Scheme != "http" && v.Scheme != "https" {
-			continue
+		switch attr.Key {
+		case "rel":
+			link.Rel = strings.TrimSpace(attr.Val)
+		case "title":
+			link.Title = strings.TrimSpace(attr.Val)
+		case "target":
+			link.Target = strings.TrimSpace(attr.Val)
+		case "hreflang":
+			link.Hreflang = strings.TrimSpace(attr.Val)
+		case "href":
+			link.URL = linkURL(base, attr.Val)
 		}
-		v = base.ResolveReference(v)
-		v.Fragment = ""
-		link.URL = v.String()
 	}
 	if link.URL == "" {
 		return nil
 	}
+	link.Text = nodeText(n)
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type != html.ElementNode {
+			continue
+		}
+		switch p.Data {
+		case "nav":
+			link.InNav = true
+		case "footer":
+			link.InFooter = true
+		}
+	}
 	return &link
 }
 
+// linkURL resolves the href of a link, returning an empty string for
+// invalid URLs and schemes other than http and https
+func linkURL(base *url.URL, href string) string {
+	v, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return ""
+	}
+	if v.Scheme != "" && v.Scheme != "http" && v.Scheme != "https" {
+		return ""
+	}
+	v = base.ResolveReference(v)
+	v.Fragment = ""
+	return v.String()
+}
+
+// nodeText returns the text within the node with whitespace collapsed,
+// including the alt text of images
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.Data == "img":
+			for _, attr := range n.Attr {
+				if attr.Key == "alt" {
+					b.WriteString(" " + attr.Val + " ")
+				}
+			}
+		case n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style" || n.Data == "template"):
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
 func extractAssets(base *url.URL, n *html.Node) []Asset {
 	if n.Type != html.ElementNode {
 		return nil
@@ -133,13 +458,10 @@ func extractSimpleAsset(base *url.URL, n *html.Node) []Asset {
 }
 
 func assetSrcset(base *url.URL, asset Asset, srcset string) []Asset {
-	srcs := strings.Split(srcset, ",")
-	assets := make([]Asset, 0, len(srcs))
-	for _, src := range srcs {
-		src = strings.TrimSpace(src)
-		parts := strings.Split(src, " ")
-		u := parts[0]
-		v, err := url.Parse(strings.TrimSpace(u))
+	candidates := parseSrcset(srcset)
+	assets := make([]Asset, 0, len(candidates))
+	for _, c := range candidates {
+		v, err := url.Parse(c.url)
 		if err != nil {
 			continue
 		}
@@ -147,16 +469,97 @@ func assetSrcset(base *url.URL, asset Asset, srcset string) []Asset {
 		if asset.URL == "" {
 			continue
 		}
+		asset.Width, asset.Density = c.width, c.density
 		assets = append(assets, asset)
 	}
 	return assets
 }
 
+type srcsetCandidate struct {
+	url     string
+	width   int
+	density float64
+}
+
+// parseSrcset splits a srcset attribute into its candidates. It is lenient
+// with invalid descriptors, keeping the first valid one if any.
+func parseSrcset(srcset string) []srcsetCandidate {
+	var candidates []srcsetCandidate
+	for s := srcset; ; {
+		s = strings.TrimLeft(s, " \t\n\r\f,")
+		if s == "" {
+			return candidates
+		}
+		end := strings.IndexAny(s, " \t\n\r\f")
+		if end < 0 {
+			end = len(s)
+		}
+		c := srcsetCandidate{url: s[:end]}
+		s = s[end:]
+		if trimmed := strings.TrimRight(c.url, ","); trimmed != c.url {
+			// a URL ending with commas has no descriptors
+			c.url = trimmed
+		} else {
+			var descriptors string
+			descriptors, s = splitSrcsetDescriptors(s)
+			for _, d := range strings.Fields(descriptors) {
+				if c.parseDescriptor(d) {
+					break
+				}
+			}
+		}
+		candidates = append(candidates, c)
+	}
+}
+
+// splitSrcsetDescriptors returns the descriptors up to the next comma that
+// is not within parentheses and the rest of the srcset
+func splitSrcsetDescriptors(s string) (string, string) {
+	depth := 0
+	for i, c := range s {
+		switch {
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == ',' && depth == 0:
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+func (c *srcsetCandidate) parseDescriptor(d string) bool {
+	if len(d) < 2 {
+		return false
+	}
+	v := d[:len(d)-1]
+	switch d[len(d)-1] {
+	case 'w':
+		w, err := strconv.Atoi(v)
+		if err != nil || w <= 0 {
+			return false
+		}
+		c.width = w
+		return true
+	case 'x':
+		x, err := strconv.ParseFloat(v, 64)
+		if err != nil || x < 0 {
+			return false
+		}
+		c.density = x
+		return true
+	}
+	return false
+}
+
 func extractSourceAsset(base *url.URL, n *html.Node) []Asset {
 	if n.Parent == nil {
 		return nil
 	}
-	if n.Parent.Data != "picture" && n.Parent.Data != "video" {
+	switch n.Parent.Data {
+	case "picture", "video", "audio":
+	default:
 		return nil
 	}
 	assets := extractSimpleAsset(base, n)
@@ -166,6 +569,13 @@ func extractSourceAsset(base *url.URL, n *html.Node) []Asset {
 	return assets
 }
 
+func extractTrackAsset(base *url.URL, n *html.Node) []Asset {
+	if n.Parent != nil && (n.Parent.Data == "video" || n.Parent.Data == "audio") {
+		return extractSourceAsset(base, n)
+	}
+	return extractSimpleAsset(base, n)
+}
+
 func extractImgAsset(base *url.URL, n *html.Node) []Asset {
 	if n.Parent != nil && n.Parent.Data == "picture" {
 		return extractSourceAsset(base, n)
@@ -173,12 +583,78 @@ func extractImgAsset(base *url.URL, n *html.Node) []Asset {
 	return extractSimpleAsset(base, n)
 }
 
+// extractVideoAsset extracts the src of the video and its poster image, with
+// the tag video>poster
+func extractVideoAsset(base *url.URL, n *html.Node) []Asset {
+	assets := extractSimpleAsset(base, n)
+	if poster := strings.TrimSpace(attrValue(n, "poster")); poster != "" {
+		if v, err := url.Parse(poster); err == nil {
+			assets = append(assets, Asset{Tag: n.Data + ">poster", URL: base.ResolveReference(v).String()})
+		}
+	}
+	return assets
+}
+
+func extractObjectAsset(base *url.URL, n *html.Node) []Asset {
+	data := strings.TrimSpace(attrValue(n, "data"))
+	if data == "" {
+		return nil
+	}
+	v, err := url.Parse(data)
+	if err != nil {
+		return nil
+	}
+	return []Asset{{
+		Tag:  n.Data,
+		URL:  base.ResolveReference(v).String(),
+		Type: attrValue(n, "type"),
+	}}
+}
+
+func extractInputAsset(base *url.URL, n *html.Node) []Asset {
+	if !strings.EqualFold(strings.TrimSpace(attrValue(n, "type")), "image") {
+		return nil
+	}
+	asset := extractSimpleAsset(base, n)
+	for i := range asset {
+		// the type of inputs is not a media type
+		asset[i].Type = ""
+	}
+	return asset
+}
+
+// extractUseAsset extracts external references from SVG <use> elements,
+// ignoring references to elements within the same document
+func extractUseAsset(base *url.URL, n *html.Node) []Asset {
+	for _, attr := range n.Attr {
+		if attr.Key == "href" && strings.HasPrefix(strings.TrimSpace(attr.Val), "#") {
+			return nil
+		}
+	}
+	return extractSimpleAsset(base, n)
+}
+
+// assetLinkRels are the link relations for resources used by the page
+var assetLinkRels = map[string]bool{
+	"stylesheet":                   true,
+	"icon":                         true,
+	"apple-touch-icon":             true,
+	"apple-touch-icon-precomposed": true,
+	"mask-icon":                    true,
+	"preload":                      true,
+	"modulepreload":                true,
+	"manifest":                     true,
+}
+
 func extractLinkAsset(base *url.URL, n *html.Node) []Asset {
 	assets := extractSimpleAsset(base, n)
 	res := assets[0:0]
 	for _, asset := range assets {
-		if asset.Rel == "stylesheet" {
-			res = append(res, asset)
+		for _, rel := range strings.Fields(strings.ToLower(asset.Rel)) {
+			if assetLinkRels[rel] {
+				res = append(res, asset)
+				break
+			}
 		}
 	}
 	return res
@@ -189,7 +665,15 @@ type extractAssetFunc func(*url.URL, *html.Node) []Asset
 var extractTag = map[string]extractAssetFunc{
 	"link":   extractLinkAsset,
 	"source": extractSourceAsset,
+	"track":  extractTrackAsset,
 	"img":    extractImgAsset,
 	"script": extractSimpleAsset,
-	"video":  extractSimpleAsset,
+	"style":  extractStyleAsset,
+	"video":  extractVideoAsset,
+	"audio":  extractSimpleAsset,
+	"iframe": extractSimpleAsset,
+	"embed":  extractSimpleAsset,
+	"object": extractObjectAsset,
+	"input":  extractInputAsset,
+	"use":    extractUseAsset,
 }
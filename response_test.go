@@ -1,13 +1,51 @@
 package crawler
 
 import (
+	"encoding/json"
+	"fmt"
+	"html"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 )
 
+func TestExtractMetaRefresh(t *testing.T) {
+	base, err := url.Parse("https://example/dir/page")
+	require.NoError(t, err)
+
+	tests := []struct {
+		content  string
+		expected string
+		link     string
+	}{
+		{content: "0;url=/other", expected: "https://example/other"},
+		{content: "1; URL = 'next'", expected: "https://example/dir/next"},
+		{content: "30; URL = 'next'", link: "https://example/dir/next"},
+		{content: `0, "https://another.test/"`, expected: "https://another.test/"},
+		{content: "0;url=page", expected: ""},
+		{content: "30", expected: ""},
+		{content: "soon;url=/other", expected: ""},
+		{content: "0;url=javascript:alert(1)", expected: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.content, func(t *testing.T) {
+			doc := fmt.Sprintf(`<meta http-equiv="refresh" content="%s">`, html.EscapeString(test.content))
+			var res Response
+			require.NoError(t, ReadResponse(base, strings.NewReader(doc), &res))
+			require.Equal(t, test.expected, res.RedirectTo)
+			if test.link == "" {
+				require.Empty(t, res.Links)
+			} else {
+				require.Equal(t, []Link{{URL: test.link}}, res.Links)
+			}
+		})
+	}
+}
+
 func TestReadResponse(t *testing.T) {
 	var u = func(uri string) *url.URL {
 		u, err := url.Parse(uri)
@@ -26,13 +64,14 @@ func TestReadResponse(t *testing.T) {
 			base: u("https://base.test/path/to/request"),
 			file: "testdata/index.html",
 			expects: Response{
-				URL: "https://base.test/path/to/request",
+				URL:     "https://base.test/path/to/request",
+				Charset: "utf-8",
 				Links: []Link{
-					{URL: "http://example.localhost/absolute/url"},
-					{URL: "https://base.test/absolute/path"},
-					{URL: "https://base.test/path/relative/path"},
-					{URL: "https://base.test/path/to/request"},
-					{URL: "https://base.test/path/to/link-with-anchor/test"},
+					{URL: "http://example.localhost/absolute/url", Text: "Absolute URL", Title: "test", Line: 15, Column: 6},
+					{URL: "https://base.test/absolute/path", Text: "Absolute path", Line: 17, Column: 9},
+					{URL: "https://base.test/path/relative/path", Text: "Relative path", Line: 18, Column: 9},
+					{URL: "https://base.test/path/to/request", Text: "Back up", Line: 20, Column: 3},
+					{URL: "https://base.test/path/to/link-with-anchor/test", Text: "link somewhere else with anchor", Line: 21, Column: 3},
 				},
 				Assets: []Asset{
 					{Tag: "script", URL: "https://base.test/path/to/example/javascript.js", Type: "text/javascript"},
@@ -40,25 +79,30 @@ func TestReadResponse(t *testing.T) {
 					{Tag: "img", URL: "https://base.test/path/to/logo.svg"},
 					{Tag: "script", URL: "https://base.test/path/to/in-body.js", Type: "text/javascript"},
 				},
+				Meta: &Meta{
+					Title:     "Example",
+					Canonical: "http://localhost",
+				},
 			},
 		},
 		{
 			base: u("https://example"),
 			file: "testdata/assets.html",
 			expects: Response{
-				URL: "https://example",
+				URL:     "https://example",
+				Charset: "utf-8",
 				Assets: []Asset{
 					{Tag: "script", URL: "https://example/example/javascript.js", Type: "text/javascript"},
 					{Tag: "link", URL: "http://ok.test/style.css", Rel: "stylesheet", Type: "text/css"},
 					{Tag: "img", URL: "https://example/logo.svg"},
 					{Tag: "script", URL: "https://example/in-body.js", Type: "text/javascript"},
 					{Tag: "picture>source", URL: "https://example/images/kitten-stretching.png"},
-					{Tag: "picture>source", URL: "https://example/images/kitten-stretching@1.5x.png"},
-					{Tag: "picture>source", URL: "https://example/images/kitten-stretching@2x.png"},
+					{Tag: "picture>source", URL: "https://example/images/kitten-stretching@1.5x.png", Density: 1.5},
+					{Tag: "picture>source", URL: "https://example/images/kitten-stretching@2x.png", Density: 2},
 					{Tag: "picture>source", URL: "https://example/images/kitten-sitting.png"},
-					{Tag: "picture>source", URL: "https://example/images/kitten-sitting@1.5x.png"},
-					{Tag: "picture>img", URL: "https://example/images/kitten-curled@1.5x.png"},
-					{Tag: "picture>img", URL: "https://example/images/kitten-curled@2x.png"},
+					{Tag: "picture>source", URL: "https://example/images/kitten-sitting@1.5x.png", Density: 1.5},
+					{Tag: "picture>img", URL: "https://example/images/kitten-curled@1.5x.png", Density: 1.5},
+					{Tag: "picture>img", URL: "https://example/images/kitten-curled@2x.png", Density: 2},
 					{Tag: "picture>source", URL: "https://example/images/kitten-stretching.png"},
 					{Tag: "picture>source", URL: "https://example/images/kitten-sitting.png"},
 					{Tag: "picture>img", URL: "https://example/images/kitten-curled.png"},
@@ -68,8 +112,155 @@ func TestReadResponse(t *testing.T) {
 					{Tag: "video>source", URL: "https://example/devstories.webm", Type: `video/webm;codecs="vp8, vorbis"`},
 					{Tag: "video>source", URL: "https://example/devstories.mp4", Type: `video/mp4;codecs="avc1.42E01E, mp4a.40.2"`},
 					{Tag: "video>source", URL: "https://example/devstories.webm#t=10,20", Type: `video/webm;codecs="vp8, vorbis"`},
+					{Tag: "video>poster", URL: "https://example/poster.png"},
 					{Tag: "video>source", URL: "https://example/devstories.webm", Type: `video/webm;codecs="vp8, vorbis"`},
 					{Tag: "video>source", URL: "https://example/devstories.mp4", Type: `video/mp4;codecs="avc1.42E01E, mp4a.40.2"`},
+					{Tag: "video>track", URL: "https://example/devstories-en.vtt"},
+				},
+				Meta: &Meta{
+					Title:     "Example",
+					Canonical: "http://localhost",
+				},
+			},
+		},
+		{
+			base: u("https://example/more-assets.html"),
+			file: "testdata/more-assets.html",
+			expects: Response{
+				URL:     "https://example/more-assets.html",
+				Charset: "utf-8",
+				Assets: []Asset{
+					{Tag: "link", URL: "https://example/favicon.ico", Rel: "icon", Type: "image/x-icon"},
+					{Tag: "link", URL: "https://example/touch.png", Rel: "apple-touch-icon"},
+					{Tag: "link", URL: "https://example/font.woff2", Rel: "preload", Type: "font/woff2"},
+					{Tag: "link", URL: "https://example/app.mjs", Rel: "modulepreload"},
+					{Tag: "link", URL: "https://example/site.webmanifest", Rel: "manifest"},
+					{Tag: "iframe", URL: "https://video.test/embed/1"},
+					{Tag: "embed", URL: "https://example/movie.swf", Type: "application/x-shockwave-flash"},
+					{Tag: "object", URL: "https://example/doc.pdf", Type: "application/pdf"},
+					{Tag: "audio", URL: "https://example/song.mp3"},
+					{Tag: "audio>source", URL: "https://example/song.ogg", Type: "audio/ogg"},
+					{Tag: "audio>track", URL: "https://example/lyrics.vtt"},
+					{Tag: "input", URL: "https://example/submit.png"},
+					{Tag: "use", URL: "https://example/sprite.svg#icon"},
+					{Tag: "img", URL: "https://example/small.png", Width: 320},
+					{Tag: "img", URL: "https://example/medium.png", Width: 640},
+					{Tag: "img", URL: "data:image/png;base64,a,b", Density: 1},
+				},
+				Meta: &Meta{
+					Alternates: []Alternate{
+						{URL: "https://example/feed.xml", Type: "application/rss+xml"},
+					},
+				},
+			},
+		},
+		{
+			base: u("https://example/nofollow.html"),
+			file: "testdata/nofollow.html",
+			expects: Response{
+				URL:     "https://example/nofollow.html",
+				Charset: "utf-8",
+				Links: []Link{
+					{URL: "https://example/depth-one.html", Rel: "nofollow", Text: "not followed", Line: 6, Column: 3},
+					{URL: "https://example/depth-two.html", Rel: "external nofollow", Text: "not followed", Line: 7, Column: 3},
+					{URL: "https://example/start-cycle.html", Rel: "ugc", Text: "followed", Line: 8, Column: 3},
+				},
+				Robots: &RobotsDirectives{
+					NoIndex:    true,
+					Directives: []string{"noindex", "noarchive"},
+				},
+			},
+		},
+		{
+			base: u("https://example/path/base-href.html"),
+			file: "testdata/base-href.html",
+			expects: Response{
+				URL:     "https://example/path/base-href.html",
+				Charset: "utf-8",
+				Links: []Link{
+					{URL: "https://example/nested/dir/page.html", Text: "relative to base", Line: 7, Column: 3},
+					{URL: "https://example/nested/sibling.html", Text: "parent of base", Line: 8, Column: 3},
+					{URL: "https://example/absolute.html", Text: "absolute path", Line: 9, Column: 3},
+					{URL: "https://other.test/", Text: "absolute url", Line: 10, Column: 3},
+				},
+				Assets: []Asset{
+					{Tag: "link", URL: "https://example/nested/dir/style.css", Rel: "stylesheet"},
+				},
+			},
+		},
+		{
+			base: u("https://example/links.html"),
+			file: "testdata/links.html",
+			expects: Response{
+				URL:     "https://example/links.html",
+				Charset: "utf-8",
+				Links: []Link{
+					{URL: "https://example/", Text: "Home", InNav: true, Line: 4, Column: 5},
+					{URL: "https://example/es/", Text: "Inicio", Hreflang: "es", InNav: true, Line: 5, Column: 5},
+					{URL: "https://other.test/", Text: "Logo Other site", Title: "Other", Target: "_blank", Line: 8, Column: 3},
+					{URL: "https://example/misnested.html", Text: "bold", Line: 11, Column: 6},
+					{URL: "https://example/misnested.html", Text: "text", Line: 11, Column: 6},
+					{URL: "https://example/contact.html", Text: "Contact ñandú", InFooter: true, Line: 13, Column: 18},
+				},
+				Assets: []Asset{
+					{Tag: "img", URL: "https://example/logo.png"},
+				},
+			},
+		},
+		{
+			base: u("https://example/meta.html?page=1"),
+			file: "testdata/meta.html",
+			expects: Response{
+				URL:     "https://example/meta.html?page=1",
+				Charset: "utf-8",
+				Meta: &Meta{
+					Title:       "Page title",
+					Description: "A page with metadata",
+					Canonical:   "https://example/meta.html",
+					Alternates: []Alternate{
+						{URL: "https://example/es/meta.html", Hreflang: "es"},
+						{URL: "https://example/feed.xml", Type: "application/rss+xml"},
+					},
+					Lang: "en-GB",
+					Headings: []Heading{
+						{Level: 1, Text: "Main heading"},
+						{Level: 2, Text: "Section"},
+						{Level: 3, Text: "Subsection"},
+						{Level: 2, Text: "Another section"},
+					},
+					OpenGraph: []MetaProperty{
+						{Property: "og:title", Content: "Open Graph title"},
+						{Property: "og:image", Content: "https://example/one.png"},
+						{Property: "og:image", Content: "https://example/two.png"},
+					},
+					Twitter: []MetaProperty{
+						{Property: "twitter:card", Content: "summary"},
+					},
+				},
+			},
+		},
+		{
+			base: u("https://example/styles.html"),
+			file: "testdata/styles.html",
+			expects: Response{
+				URL:     "https://example/styles.html",
+				Charset: "utf-8",
+				Assets: []Asset{
+					{Tag: "css>import", URL: "https://example/theme.css"},
+					{Tag: "css>url", URL: "https://example/images/header.jpg"},
+					{Tag: "css>url", URL: "https://example/images/inline.png"},
+				},
+			},
+		},
+		{
+			base: u("https://example/meta-refresh.html"),
+			file: "testdata/meta-refresh.html",
+			expects: Response{
+				URL:        "https://example/meta-refresh.html",
+				Charset:    "utf-8",
+				RedirectTo: "https://example/depth-one.html",
+				Links: []Link{
+					{URL: "https://example/start-cycle.html", Text: "still a link", Line: 6, Column: 3},
 				},
 			},
 		},
@@ -89,3 +280,133 @@ func TestReadResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestReadResponseStructuredData(t *testing.T) {
+	r := require.New(t)
+
+	base, err := url.Parse("https://example/structured.html")
+	r.NoError(err)
+	f, err := os.Open("testdata/structured.html")
+	r.NoError(err)
+	defer f.Close()
+
+	var res Response
+	r.NoError(ReadResponse(base, f, &res))
+	r.Len(res.StructuredData, 4)
+
+	jsonld := res.StructuredData[0]
+	r.Equal(JSONLD, jsonld.Format)
+	r.Equal(map[string]interface{}{
+		"@context": "https://schema.org",
+		"@type":    "Organization",
+		"name":     "Example",
+		"founded":  json.Number("1999"),
+	}, jsonld.JSON)
+	r.Equal(3, jsonld.Line)
+	r.Equal(3, jsonld.Column)
+	r.Empty(jsonld.Error)
+
+	broken := res.StructuredData[1]
+	r.Equal(JSONLD, broken.Format)
+	r.Nil(broken.JSON)
+	r.NotEmpty(broken.Error)
+	r.Equal(6, broken.Line)
+
+	r.Equal(StructuredData{
+		Format: Microdata,
+		Item: &Item{
+			Type: []string{"https://schema.org/Product"},
+			ID:   "urn:sku:1",
+			Properties: map[string][]interface{}{
+				"name":  {"Kettle"},
+				"image": {"https://example/kettle.png"},
+				"offers": {&Item{
+					Type: []string{"https://schema.org/Offer"},
+					Properties: map[string][]interface{}{
+						"priceCurrency": {"EUR"},
+						"price":         {"25.00"},
+					},
+				}},
+				"description": {"Electric kettle"},
+				"category":    {"Electric kettle"},
+			},
+		},
+		Line:   9,
+		Column: 3,
+	}, res.StructuredData[2])
+
+	r.Equal(StructuredData{
+		Format: RDFa,
+		Item: &Item{
+			Type: []string{"https://schema.org/Person"},
+			ID:   "#jane",
+			Properties: map[string][]interface{}{
+				"name": {"Jane"},
+				"url":  {"https://example/jane"},
+				"address": {&Item{
+					Type: []string{"https://schema.org/PostalAddress"},
+					Properties: map[string][]interface{}{
+						"addressLocality": {"Madrid"},
+					},
+				}},
+			},
+		},
+		Line:   18,
+		Column: 3,
+	}, res.StructuredData[3])
+}
+
+func TestReadResponseCharset(t *testing.T) {
+	base, err := url.Parse("https://example/")
+	require.NoError(t, err)
+
+	tests := []struct {
+		file        string
+		contentType string
+		charset     string
+		link        Link
+	}{
+		{
+			file:    "testdata/shift_jis.html",
+			charset: "shift_jis",
+			link:    Link{URL: "https://example/%E6%A4%9C%E7%B4%A2?q=日本語", Text: "日本語のページ", Line: 6, Column: 3},
+		},
+		{
+			file:        "testdata/latin1.html",
+			contentType: "text/html; charset=ISO-8859-1",
+			charset:     "windows-1252",
+			link:        Link{URL: "https://example/caf%C3%A9.html", Text: "Café crème", Line: 3, Column: 3},
+		},
+		{
+			// the header takes precedence over <meta charset>
+			file:        "testdata/shift_jis.html",
+			contentType: "text/html; charset=utf-8",
+			charset:     "utf-8",
+		},
+		{
+			file:    "testdata/utf16.html",
+			charset: "utf-16le",
+			link:    Link{URL: "https://example/%C3%B1.html", Text: "Mañana", Line: 1, Column: 13},
+		},
+		{
+			file:    "testdata/depth-one.html",
+			charset: "utf-8",
+			link:    Link{URL: "https://example/depth-two.html", Text: "depth two", Line: 1, Column: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file+" "+test.contentType, func(t *testing.T) {
+			f, err := os.Open(test.file)
+			require.NoError(t, err)
+			defer f.Close()
+
+			res := Response{ContentType: test.contentType}
+			require.NoError(t, ReadResponse(base, f, &res))
+			require.Equal(t, test.charset, res.Charset)
+			if test.link.URL != "" {
+				require.Equal(t, []Link{test.link}, res.Links)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures how fetches failing with network errors, timeouts,
+// temporary DNS failures, 429 or 5xx responses are retried
+type RetryPolicy struct {
+	// MaxAttempts is the maximum amount of times a URL is fetched, including
+	// the first attempt
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry. It doubles for every
+	// following retry
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay between retries, including the delays asked
+	// by Retry-After headers. Zero means no limit
+	MaxDelay time.Duration
+}
+
+// RetryError is passed to the CrawlFunc when a URL failed to be fetched
+// after being retried
+type RetryError struct {
+	// Attempts is the amount of times the URL was fetched
+	Attempts int
+
+	// Err is the error from the last attempt
+	Err error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%s (after %d attempts)", e.Err, e.Attempts)
+}
+
+// Cause returns the error from the last attempt
+func (e *RetryError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the error from the last attempt
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// retryable returns whether the error from fetching the given request should
+// be retried and how long to wait before doing so
+func (p *RetryPolicy) retryable(req *Request, err error) (time.Duration, bool) {
+	if req.attempts+1 >= p.MaxAttempts {
+		return 0, false
+	}
+	var retryAfter time.Duration
+	switch err := err.(type) {
+	case *NetworkError, *TimeoutError:
+	case *DNSError:
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !(dnsErr.IsTemporary || dnsErr.IsTimeout) {
+			return 0, false
+		}
+	case *HTTPError:
+		if err.StatusCode != http.StatusTooManyRequests && err.StatusCode < 500 {
+			return 0, false
+		}
+		retryAfter = parseRetryAfter(err.Header.Get("Retry-After"), time.Now())
+	default:
+		return 0, false
+	}
+	delay := p.backoff(req.attempts + 1)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay, true
+}
+
+// backoff returns the delay before the given retry, doubling the base delay
+// for each retry and picking a random delay between half and the full value
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < retry && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// parseRetryAfter parses the Retry-After header in either of its forms:
+// seconds or an HTTP date
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// scheduleRetry queues the request again once the delay has passed without blocking
+// the worker. The original request is kept unfinished until then so the
+// queue is not exhausted.
+func (w *Worker) scheduleRetry(q Queue, req *Request, delay time.Duration) {
+	next := &Request{
+		URL:       req.URL,
+		depth:     req.depth,
+		redirects: req.redirects,
+		attempts:  req.attempts + 1,
+		chain:     req.chain,
+		sitemap:   req.sitemap,
+	}
+	time.AfterFunc(delay, func() {
+		defer req.Finish()
+		// the queue refuses new requests once the crawl is cancelled
+		q.PushBack(next)
+	})
+}
@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		retry int
+		max   time.Duration
+	}{
+		{retry: 1, max: 100 * time.Millisecond},
+		{retry: 2, max: 200 * time.Millisecond},
+		{retry: 3, max: 400 * time.Millisecond},
+		{retry: 4, max: 800 * time.Millisecond},
+		{retry: 5, max: time.Second},
+		{retry: 50, max: time.Second},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			d := p.backoff(test.retry)
+			require.True(t, d >= test.max/2 && d <= test.max, "retry %d: %s not within [%s, %s]", test.retry, d, test.max/2, test.max)
+		}
+	}
+}
+
+func TestRetryAfterCappedByMaxDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	req, err := NewRequest("http://example.test/")
+	require.NoError(t, err)
+
+	delay, ok := p.retryable(req, &HTTPError{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"Retry-After": []string{"3600"}},
+	})
+	require.True(t, ok)
+	require.Equal(t, time.Second, delay)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2018, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	require.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	require.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	require.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+	require.Equal(t, 30*time.Second, parseRetryAfter("Sun, 01 Apr 2018 12:00:30 GMT", now))
+	require.Equal(t, time.Duration(0), parseRetryAfter("Sun, 01 Apr 2018 11:00:00 GMT", now))
+	require.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
+
+func TestCrawlWithRetryPolicy(t *testing.T) {
+	var (
+		mut      sync.Mutex
+		requests = make(map[string]int)
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		mut.Unlock()
+
+		switch r.URL.Path {
+		case "/flaky":
+			if n < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/broken">broken</a> <a href="/missing">missing</a>`))
+		case "/broken":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	c, err := New(WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+	require.NoError(t, err)
+
+	var (
+		responses = make(map[string]*Response)
+		errs      = make(map[string]error)
+	)
+	err = c.Crawl(s.URL+"/flaky", func(url string, res *Response, err error) error {
+		responses[url] = res
+		errs[url] = err
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, errs[s.URL+"/flaky"])
+	require.Equal(t, 3, responses[s.URL+"/flaky"].Attempts)
+
+	retryErr, ok := errs[s.URL+"/broken"].(*RetryError)
+	require.True(t, ok, "expected *RetryError, got %#v", errs[s.URL+"/broken"])
+	require.Equal(t, 3, retryErr.Attempts)
+
+	// client errors are not retried
+	require.Error(t, errs[s.URL+"/missing"])
+	require.IsType(t, &HTTPError{}, errs[s.URL+"/missing"])
+
+	require.Equal(t, map[string]int{"/flaky": 3, "/broken": 3, "/missing": 1}, requests)
+}
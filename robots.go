@@ -0,0 +1,319 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDisallowedByRobots is wrapped by the *DisallowedError passed to the
+// CrawlFunc for the URLs that were not fetched because the robots.txt of
+// their host disallows them
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+// maxRobotsSize is the maximum amount of bytes read from a robots.txt file
+const maxRobotsSize = 500 << 10
+
+// robotsRules are the rules from a robots.txt file that apply to a single
+// user agent
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+
+	// sitemaps lists the Sitemap lines, which apply to every user agent
+	sitemaps []string
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+var (
+	robotsAllowAll    = &robotsRules{}
+	robotsDisallowAll = &robotsRules{rules: []robotsRule{{pattern: "/"}}}
+)
+
+// allowed checks whether the given URL can be fetched. The longest matching
+// pattern wins and allow rules win over disallow rules of the same length.
+func (r *robotsRules) allowed(u *url.URL) bool {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	var (
+		allow   = true
+		longest = -1
+	)
+	for _, rule := range r.rules {
+		if len(rule.pattern) < longest || !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) == longest && !rule.allow {
+			continue
+		}
+		longest = len(rule.pattern)
+		allow = rule.allow
+	}
+	return allow
+}
+
+// robotsMatch matches a path against a robots.txt pattern where * matches
+// any sequence of characters and a trailing $ anchors the end of the path
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	if len(parts) == 1 {
+		return !anchored || len(path) == len(parts[0])
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path[pos:], part)
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+	return true
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// parseRobots reads a robots.txt file and returns the rules for the given
+// user agent. Groups naming the user agent take precedence over the * group.
+func parseRobots(r io.Reader, userAgent string) (*robotsRules, error) {
+	var (
+		groups   []*robotsGroup
+		current  *robotsGroup
+		inRules  bool
+		sitemaps []string
+	)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		key, val, ok := robotsLine(s.Text())
+		if !ok {
+			continue
+		}
+		switch key {
+		case "user-agent":
+			if current == nil || inRules {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+				inRules = false
+			}
+			current.agents = append(current.agents, strings.ToLower(val))
+		case "allow", "disallow":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			if val == "" {
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{
+				allow:   key == "allow",
+				pattern: val,
+			})
+		case "sitemap":
+			if val != "" {
+				sitemaps = append(sitemaps, val)
+			}
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			if secs, err := strconv.ParseFloat(val, 64); err == nil && secs > 0 {
+				current.crawlDelay = time.Duration(secs * float64(time.Second))
+			}
+		default:
+			if current != nil {
+				inRules = true
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	rules := robotsRulesFor(groups, userAgent)
+	rules.sitemaps = sitemaps
+	return rules, nil
+}
+
+func robotsLine(line string) (key, val string, ok bool) {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	i := strings.IndexByte(line, ':')
+	if i < 0 {
+		return "", "", false
+	}
+	key = strings.ToLower(strings.TrimSpace(line[:i]))
+	val = strings.TrimSpace(line[i+1:])
+	return key, val, key != ""
+}
+
+// robotsRulesFor merges the groups matching the most specific agent name
+// found in userAgent, falling back to the * groups
+func robotsRulesFor(groups []*robotsGroup, userAgent string) *robotsRules {
+	userAgent = strings.ToLower(userAgent)
+	var (
+		best     string
+		rules    = &robotsRules{}
+		wildcard = &robotsRules{}
+	)
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			switch {
+			case agent == "*":
+				wildcard.merge(g)
+			case !strings.Contains(userAgent, agent) || len(agent) < len(best):
+			case len(agent) > len(best):
+				best = agent
+				rules = &robotsRules{}
+				rules.merge(g)
+			default:
+				rules.merge(g)
+			}
+		}
+	}
+	if best == "" {
+		return wildcard
+	}
+	return rules
+}
+
+func (r *robotsRules) merge(g *robotsGroup) {
+	r.rules = append(r.rules, g.rules...)
+	if g.crawlDelay > r.crawlDelay {
+		r.crawlDelay = g.crawlDelay
+	}
+}
+
+// robotsCache fetches the robots.txt of each host once and keeps the rules
+// for the rest of the crawl
+type robotsCache struct {
+	client    *http.Client
+	userAgent string
+
+	mut   sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	ready chan struct{}
+	rules *robotsRules
+	err   error
+}
+
+func newRobotsCache(rt http.RoundTripper, userAgent string) *robotsCache {
+	return &robotsCache{
+		client:    &http.Client{Transport: rt},
+		userAgent: userAgent,
+		hosts:     make(map[string]*robotsEntry),
+	}
+}
+
+// allowed checks whether the request can be fetched according to the
+// robots.txt of its host
+func (c *robotsCache) allowed(ctx context.Context, req *Request) (bool, error) {
+	rules, err := c.rules(ctx, req.URL)
+	if err != nil {
+		return false, err
+	}
+	return rules.allowed(req.URL), nil
+}
+
+func (c *robotsCache) rules(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	key := u.Scheme + "://" + u.Host
+
+	c.mut.Lock()
+	e, ok := c.hosts[key]
+	if !ok {
+		e = &robotsEntry{ready: make(chan struct{})}
+		c.hosts[key] = e
+	}
+	c.mut.Unlock()
+
+	if ok {
+		select {
+		case <-e.ready:
+			return e.rules, e.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	e.rules, e.err = c.fetch(ctx, key)
+	if e.err != nil {
+		// do not cache failures so the next request tries again
+		c.mut.Lock()
+		delete(c.hosts, key)
+		c.mut.Unlock()
+	}
+	close(e.ready)
+	return e.rules, e.err
+}
+
+// fetch retrieves the robots.txt for the given scheme and host. Following
+// the conventions, 4xx responses allow everything while 429 and 5xx
+// responses disallow everything. When robots.txt cannot be fetched at all
+// everything is allowed, so the fetch of the page itself reports the error.
+func (c *robotsCache) fetch(ctx context.Context, schemeHost string) (*robotsRules, error) {
+	httpReq, err := http.NewRequest(http.MethodGet, schemeHost+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	if c.userAgent != "" {
+		httpReq.Header.Set("User-Agent", c.userAgent)
+	}
+
+	httpRes, err := c.client.Do(httpReq)
+	if err != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return robotsAllowAll, nil
+	}
+	defer httpRes.Body.Close()
+
+	switch {
+	case httpRes.StatusCode >= 200 && httpRes.StatusCode < 300:
+		rules, err := parseRobots(io.LimitReader(httpRes.Body, maxRobotsSize), c.userAgent)
+		if err != nil {
+			return robotsAllowAll, nil
+		}
+		return rules, nil
+	case httpRes.StatusCode == http.StatusTooManyRequests, httpRes.StatusCode >= 500:
+		return robotsDisallowAll, nil
+	default:
+		return robotsAllowAll, nil
+	}
+}
@@ -0,0 +1,219 @@
+package crawler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{pattern: "/", path: "/", match: true},
+		{pattern: "/fish", path: "/fish.html", match: true},
+		{pattern: "/fish", path: "/Fish.html", match: false},
+		{pattern: "/fish/", path: "/fish", match: false},
+		{pattern: "/*.php", path: "/folder/filename.php?parameters", match: true},
+		{pattern: "/*.php", path: "/index.html", match: false},
+		{pattern: "/*.php$", path: "/filename.php", match: true},
+		{pattern: "/*.php$", path: "/filename.php?parameters", match: false},
+		{pattern: "/fish*.php", path: "/fishheads/catfish.php?parameters", match: true},
+		{pattern: "/fish*.php", path: "/fish.ph", match: false},
+		{pattern: "/exact$", path: "/exact", match: true},
+		{pattern: "/exact$", path: "/exactly", match: false},
+		{pattern: "/a*b*c$", path: "/abcbc", match: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.path, func(t *testing.T) {
+			require.Equal(t, test.match, robotsMatch(test.pattern, test.path))
+		})
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	const robots = `# comment
+User-agent: *
+Disallow: /private
+Allow: /private/public
+
+User-agent: otherbot
+Disallow: /
+
+User-agent: TestBot
+User-agent: anotherbot
+Disallow: /page     # only for testbot
+Allow: /page$
+`
+
+	tests := []struct {
+		userAgent string
+		path      string
+		allowed   bool
+	}{
+		{userAgent: "somebot", path: "/", allowed: true},
+		{userAgent: "somebot", path: "/private/file", allowed: false},
+		{userAgent: "somebot", path: "/private/public/file", allowed: true},
+		{userAgent: "somebot", path: "/robots.txt", allowed: true},
+		{userAgent: "otherbot/1.0", path: "/anything", allowed: false},
+		{userAgent: "otherbot/1.0", path: "/robots.txt", allowed: true},
+		{userAgent: "testbot/2.1", path: "/private/file", allowed: true},
+		{userAgent: "testbot/2.1", path: "/page", allowed: true},
+		{userAgent: "testbot/2.1", path: "/page/other", allowed: false},
+		{userAgent: "testbot/2.1", path: "/page?query", allowed: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.userAgent+" "+test.path, func(t *testing.T) {
+			rules, err := parseRobots(strings.NewReader(robots), test.userAgent)
+			require.NoError(t, err)
+
+			u, err := url.Parse("http://example.test" + test.path)
+			require.NoError(t, err)
+
+			require.Equal(t, test.allowed, rules.allowed(u))
+		})
+	}
+}
+
+func TestParseRobotsSitemaps(t *testing.T) {
+	const robots = `Sitemap: http://example.test/sitemap-1.xml
+User-agent: testbot
+Disallow: /private
+sitemap: http://example.test/sitemap-2.xml.gz
+Allow: /private/public
+`
+	rules, err := parseRobots(strings.NewReader(robots), "testbot")
+	require.NoError(t, err)
+	require.Equal(t, []string{"http://example.test/sitemap-1.xml", "http://example.test/sitemap-2.xml.gz"}, rules.sitemaps)
+	require.Len(t, rules.rules, 2)
+}
+
+func TestCrawlWithRobotsTxt(t *testing.T) {
+	tests := []struct {
+		name     string
+		robots   func(http.ResponseWriter)
+		expected func(s *httptest.Server) []expectedPage
+	}{
+		{
+			name: "disallowed",
+			robots: func(w http.ResponseWriter) {
+				w.Write([]byte("User-agent: testbot\nDisallow: /depth-three.html\n"))
+			},
+			expected: func(s *httptest.Server) []expectedPage {
+				return []expectedPage{
+					{url: s.URL + "/depth-one.html", totalLinks: 1},
+					{url: s.URL + "/depth-two.html", totalLinks: 2},
+					{url: s.URL + "/depth-three.html", hasError: true},
+					{url: s.URL + "/", totalLinks: 5, totalAssets: 4},
+				}
+			},
+		},
+		{
+			name: "missing",
+			robots: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			expected: func(s *httptest.Server) []expectedPage {
+				return []expectedPage{
+					{url: s.URL + "/depth-one.html", totalLinks: 1},
+					{url: s.URL + "/depth-two.html", totalLinks: 2},
+					{url: s.URL + "/depth-three.html", totalLinks: 1},
+					{url: s.URL + "/", totalLinks: 5, totalAssets: 4},
+					{url: s.URL + "/depth-four.html", totalLinks: 1},
+				}
+			},
+		},
+		{
+			name: "unavailable",
+			robots: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			expected: func(s *httptest.Server) []expectedPage {
+				return []expectedPage{
+					{url: s.URL + "/depth-one.html", hasError: true},
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := http.FileServer(http.Dir("testdata"))
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/robots.txt" {
+					test.robots(w)
+					return
+				}
+				fs.ServeHTTP(w, r)
+			}))
+			defer s.Close()
+
+			c, err := New(WithRobotsTxt("testbot"), WithAllowedHosts(s.Listener.Addr().String()))
+			require.NoError(t, err)
+
+			var actual []expectedPage
+			err = c.Crawl(s.URL+"/depth-one.html", func(url string, res *Response, err error) error {
+				result := expectedPage{url: url}
+				var disallowed *DisallowedError
+				switch {
+				case err == nil:
+					result.totalLinks = len(res.Links)
+					result.totalAssets = len(res.Assets)
+				case errors.As(err, &disallowed):
+					require.True(t, errors.Is(err, ErrDisallowedByRobots))
+					require.Equal(t, url, disallowed.URL)
+					result.hasError = true
+				default:
+					// broken links from the testdata are not relevant here
+					return nil
+				}
+				actual = append(actual, result)
+				return nil
+			})
+			require.NoError(t, err)
+
+			require.Equal(t, test.expected(s), actual)
+		})
+	}
+}
+
+func TestCrawlWithRobotsTxtUserAgent(t *testing.T) {
+	r := require.New(t)
+	var agents sync.Map
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents.Store(r.Method+" "+r.URL.Path, r.UserAgent())
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.WriteHeader(http.StatusNotFound)
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/page">page</a><img src="/logo.png">`))
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer s.Close()
+
+	c, err := New(WithRobotsTxt("testbot"), WithFetchAssets(CheckAssets))
+	r.NoError(err)
+	err = c.Crawl(s.URL+"/", func(url string, res *Response, err error) error {
+		return err
+	})
+	r.NoError(err)
+
+	for _, req := range []string{"GET /robots.txt", "GET /", "GET /page", "HEAD /logo.png"} {
+		agent, ok := agents.Load(req)
+		r.True(ok, req)
+		r.Equal("testbot", agent, req)
+	}
+}
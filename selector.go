@@ -0,0 +1,140 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+// xpathPrefix marks selectors using XPath instead of CSS
+const xpathPrefix = "xpath:"
+
+// selector is a compiled selector from WithSelectors
+type selector struct {
+	name string
+
+	// css selector and the attribute to read from the matches, if any
+	css  cascadia.Sel
+	attr string
+
+	xpath *xpath.Expr
+}
+
+// compileSelectors compiles the selectors from WithSelectors sorted by name
+func compileSelectors(selectors map[string]string) ([]selector, error) {
+	names := make([]string, 0, len(selectors))
+	for name := range selectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	compiled := make([]selector, 0, len(names))
+	for _, name := range names {
+		s, err := compileSelector(name, selectors[name])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid selector %q", name)
+		}
+		compiled = append(compiled, s)
+	}
+	return compiled, nil
+}
+
+func compileSelector(name, expr string) (selector, error) {
+	s := selector{name: name}
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return s, errors.New("empty selector")
+	}
+	if strings.HasPrefix(expr, xpathPrefix) {
+		x, err := xpath.Compile(strings.TrimSpace(expr[len(xpathPrefix):]))
+		if err != nil {
+			return s, err
+		}
+		s.xpath = x
+		return s, nil
+	}
+	if i := strings.LastIndexByte(expr, '@'); i >= 0 && isAttrName(expr[i+1:]) {
+		expr, s.attr = strings.TrimSpace(expr[:i]), strings.ToLower(expr[i+1:])
+	}
+	css, err := cascadia.Parse(expr)
+	if err != nil {
+		return s, err
+	}
+	s.css = css
+	return s, nil
+}
+
+func isAttrName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !isCSSIdent(byte(c)) && c != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// selectorExtractor stores the values matched by the selectors in
+// Response.Selected
+func selectorExtractor(selectors []selector) Extractor {
+	return ExtractorFunc(func(base *url.URL, doc *html.Node, res *Response) error {
+		for _, s := range selectors {
+			values := s.match(doc)
+			if len(values) == 0 {
+				continue
+			}
+			if res.Selected == nil {
+				res.Selected = make(map[string][]string)
+			}
+			res.Selected[s.name] = values
+		}
+		return nil
+	})
+}
+
+// match returns the text or attribute values of the nodes matched by the
+// selector
+func (s selector) match(doc *html.Node) []string {
+	var values []string
+	if s.xpath != nil {
+		switch v := s.xpath.Evaluate(htmlquery.CreateXPathNavigator(doc)).(type) {
+		case *xpath.NodeIterator:
+			for v.MoveNext() {
+				values = append(values, strings.Join(strings.Fields(v.Current().Value()), " "))
+			}
+		case string:
+			values = append(values, v)
+		case float64:
+			values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			values = append(values, strconv.FormatBool(v))
+		}
+		return values
+	}
+	for _, n := range cascadia.QueryAll(doc, s.css) {
+		if s.attr == "" {
+			values = append(values, nodeText(n))
+			continue
+		}
+		for _, attr := range n.Attr {
+			key := attr.Key
+			if attr.Namespace != "" {
+				key = attr.Namespace + ":" + key
+			}
+			if key == s.attr {
+				values = append(values, attr.Val)
+				break
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithSelectors(t *testing.T) {
+	r := require.New(t)
+
+	s := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer s.Close()
+
+	c, err := New(WithMaxDepth(1), WithSelectors(map[string]string{
+		"title":       "h1.title",
+		"breadcrumbs": ".breadcrumbs a",
+		"currency":    "span.price@data-currency",
+		"next":        "a.next@href",
+		"author":      "xpath://meta[@name='author']/@content",
+		"links":       "xpath:count(//a)",
+		"missing":     "table td",
+	}))
+	r.NoError(err)
+
+	var res *Response
+	err = c.Crawl(s.URL+"/selectors.html", func(url string, r *Response, err error) error {
+		if url == s.URL+"/selectors.html" {
+			res = r
+		}
+		return nil
+	})
+	r.NoError(err)
+	r.Equal(map[string][]string{
+		"title":       {"Electric kettle"},
+		"breadcrumbs": {"Home", "Kitchen"},
+		"currency":    {"EUR"},
+		"next":        {"page-2.html"},
+		"author":      {"Jane Doe"},
+		"links":       {"3"},
+	}, res.Selected)
+	r.Nil(res.Data)
+}
+
+func TestWithSelectorsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"empty": " ",
+		"css":   "a[href",
+		"xpath": "xpath://a[",
+	}
+	for name, sel := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(WithSelectors(map[string]string{name: sel}))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestCompileSelectorAttribute(t *testing.T) {
+	tests := []struct {
+		expr string
+		attr string
+	}{
+		{expr: "a@href", attr: "href"},
+		{expr: "svg use@xlink:href", attr: "xlink:href"},
+		{expr: `a[href$="@example.com"]`, attr: ""},
+		{expr: "a", attr: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			s, err := compileSelector("test", test.expr)
+			require.NoError(t, err)
+			require.Equal(t, test.attr, s.attr)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxSitemapSize is the maximum size of an uncompressed sitemap
+	maxSitemapSize = 50 << 20
+
+	// maxSitemapsPerHost limits how many sitemaps are read from each host
+	maxSitemapsPerHost = 1000
+)
+
+// Sitemap contains the entries from a sitemap or a sitemap index
+type Sitemap struct {
+	// URLs has the pages listed in a sitemap
+	URLs []SitemapURL `xml:"url" json:"urls,omitempty"`
+
+	// Sitemaps has the sitemaps listed in a sitemap index
+	Sitemaps []SitemapRef `xml:"sitemap" json:"sitemaps,omitempty"`
+}
+
+// SitemapURL is a page listed in a sitemap. Values are kept as found in the
+// sitemap so they can be compared with the crawl.
+type SitemapURL struct {
+	Loc        string `xml:"loc" json:"loc"`
+	LastMod    string `xml:"lastmod" json:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq" json:"changefreq,omitempty"`
+	Priority   string `xml:"priority" json:"priority,omitempty"`
+}
+
+// SitemapRef is a sitemap listed in a sitemap index
+type SitemapRef struct {
+	Loc     string `xml:"loc" json:"loc"`
+	LastMod string `xml:"lastmod" json:"lastmod,omitempty"`
+}
+
+// ParseSitemap reads a sitemap or a sitemap index in XML format. The input
+// can be gzip compressed.
+func ParseSitemap(r io.Reader) (*Sitemap, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	var doc struct {
+		XMLName xml.Name
+		Sitemap
+	}
+	if err := xml.NewDecoder(io.LimitReader(r, maxSitemapSize)).Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "parsing sitemap")
+	}
+	switch doc.XMLName.Local {
+	case "urlset", "sitemapindex":
+	default:
+		return nil, errors.Errorf("unexpected sitemap root element %q", doc.XMLName.Local)
+	}
+
+	sm := &doc.Sitemap
+	for i := range sm.URLs {
+		u := &sm.URLs[i]
+		u.Loc = strings.TrimSpace(u.Loc)
+		u.LastMod = strings.TrimSpace(u.LastMod)
+		u.ChangeFreq = strings.TrimSpace(u.ChangeFreq)
+		u.Priority = strings.TrimSpace(u.Priority)
+	}
+	for i := range sm.Sitemaps {
+		sm.Sitemaps[i].Loc = strings.TrimSpace(sm.Sitemaps[i].Loc)
+		sm.Sitemaps[i].LastMod = strings.TrimSpace(sm.Sitemaps[i].LastMod)
+	}
+	return sm, nil
+}
+
+// sitemapDiscovery finds the sitemaps of every host in the crawl and queues
+// the URLs listed on them
+type sitemapDiscovery struct {
+	client *http.Client
+	robots *robotsCache
+
+	mut   sync.Mutex
+	hosts map[string]struct{}
+}
+
+func newSitemapDiscovery(rt http.RoundTripper, robots *robotsCache) *sitemapDiscovery {
+	return &sitemapDiscovery{
+		client: &http.Client{Transport: rt},
+		robots: robots,
+		hosts:  make(map[string]struct{}),
+	}
+}
+
+// discover queues the URLs from the sitemaps of the host of req the first
+// time the host is seen. Sitemaps are taken from the Sitemap lines in
+// robots.txt and /sitemap.xml, and are fetched once prepare allows them.
+// Sitemaps that cannot be fetched are ignored.
+func (d *sitemapDiscovery) discover(ctx context.Context, q Queue, req *Request, prepare func(context.Context, *Request) error) error {
+	u := req.URL
+	schemeHost := u.Scheme + "://" + u.Host
+
+	d.mut.Lock()
+	_, seen := d.hosts[schemeHost]
+	d.hosts[schemeHost] = struct{}{}
+	d.mut.Unlock()
+	if seen {
+		return nil
+	}
+
+	rules, err := d.robots.rules(ctx, u)
+	if err != nil {
+		return err
+	}
+
+	var (
+		pending = append(append([]string(nil), rules.sitemaps...), schemeHost+"/sitemap.xml")
+		fetched = make(map[string]struct{})
+	)
+	for len(pending) > 0 && len(fetched) < maxSitemapsPerHost {
+		loc := pending[0]
+		pending = pending[1:]
+		if _, ok := fetched[loc]; ok {
+			continue
+		}
+		fetched[loc] = struct{}{}
+
+		smReq, err := NewRequest(loc)
+		if err != nil {
+			continue
+		}
+		err = prepare(ctx, smReq)
+		var sm *Sitemap
+		if err == nil {
+			sm, err = d.fetch(ctx, smReq.URL.String())
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			continue
+		}
+		for _, ref := range sm.Sitemaps {
+			pending = append(pending, ref.Loc)
+		}
+		for _, entry := range sm.URLs {
+			next, err := NewRequest(entry.Loc)
+			if err != nil || (next.URL.Scheme != "http" && next.URL.Scheme != "https") {
+				continue
+			}
+			entry := entry
+			if next.URL.String() == req.URL.String() {
+				// the URL being crawled would be skipped as already visited
+				if req.sitemap == nil {
+					req.sitemap = &entry
+				}
+				continue
+			}
+			next.sitemap = &entry
+			if err := q.PushBack(next); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *sitemapDiscovery) fetch(ctx context.Context, loc string) (*Sitemap, error) {
+	httpReq, err := http.NewRequest(http.MethodGet, loc, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	if d.robots.userAgent != "" {
+		httpReq.Header.Set("User-Agent", d.robots.userAgent)
+	}
+
+	httpRes, err := d.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s for %s", httpRes.Status, loc)
+	}
+	return ParseSitemap(httpRes.Body)
+}
@@ -0,0 +1,161 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testSitemapIndex = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap>
+    <loc>/pages.xml.gz</loc>
+    <lastmod>2004-10-01T18:23:17+00:00</lastmod>
+  </sitemap>
+</sitemapindex>`
+
+const testSitemap = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>
+      /depth-three.html
+    </loc>
+    <lastmod>2005-01-01</lastmod>
+    <changefreq>monthly</changefreq>
+    <priority>0.8</priority>
+  </url>
+  <url>
+    <loc>/loop-cycle.html</loc>
+  </url>
+</urlset>`
+
+func gzipString(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestParseSitemap(t *testing.T) {
+	r := require.New(t)
+
+	sm, err := ParseSitemap(strings.NewReader(testSitemap))
+	r.NoError(err)
+	r.Equal(&Sitemap{
+		URLs: []SitemapURL{
+			{Loc: "/depth-three.html", LastMod: "2005-01-01", ChangeFreq: "monthly", Priority: "0.8"},
+			{Loc: "/loop-cycle.html"},
+		},
+	}, sm)
+
+	sm, err = ParseSitemap(bytes.NewReader(gzipString(t, testSitemapIndex)))
+	r.NoError(err)
+	r.Equal(&Sitemap{
+		Sitemaps: []SitemapRef{
+			{Loc: "/pages.xml.gz", LastMod: "2004-10-01T18:23:17+00:00"},
+		},
+	}, sm)
+
+	_, err = ParseSitemap(strings.NewReader(`<html><body>not found</body></html>`))
+	r.Error(err)
+}
+
+func TestCrawlWithSitemaps(t *testing.T) {
+	r := require.New(t)
+
+	var s *httptest.Server
+	fs := http.FileServer(http.Dir("testdata"))
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow:\n\nSitemap: " + s.URL + "/index.xml\n"))
+		case "/index.xml":
+			w.Write([]byte(strings.Replace(testSitemapIndex, "/pages.xml.gz", s.URL+"/pages.xml.gz", 1)))
+		case "/pages.xml.gz":
+			w.Header().Set("Content-Type", "application/x-gzip")
+			w.Write(gzipString(t, strings.NewReplacer(
+				"/depth-three.html", s.URL+"/depth-three.html",
+				"/loop-cycle.html", s.URL+"/loop-cycle.html",
+			).Replace(testSitemap)))
+		case "/sitemap.xml":
+			http.NotFound(w, req)
+		default:
+			fs.ServeHTTP(w, req)
+		}
+	}))
+	defer s.Close()
+
+	c, err := New(WithSitemaps(), WithMaxDepth(1))
+	r.NoError(err)
+
+	responses := make(map[string]*Response)
+	err = c.Crawl(s.URL+"/depth-one.html", func(url string, res *Response, err error) error {
+		if err == nil {
+			responses[url] = res
+		}
+		return nil
+	})
+	r.NoError(err)
+
+	// depth-three is too deep from the start URL but it is listed in the sitemap
+	r.Contains(responses, s.URL+"/depth-three.html")
+	r.Equal(&SitemapURL{
+		Loc:        s.URL + "/depth-three.html",
+		LastMod:    "2005-01-01",
+		ChangeFreq: "monthly",
+		Priority:   "0.8",
+	}, responses[s.URL+"/depth-three.html"].Sitemap)
+
+	r.Contains(responses, s.URL+"/loop-cycle.html")
+	r.Nil(responses[s.URL+"/depth-one.html"].Sitemap)
+}
+
+func TestCrawlWithSitemapsRobotsTxt(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		s         *httptest.Server
+		requested sync.Map
+	)
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requested.Store(req.URL.Path, true)
+		switch req.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private.xml\n\nSitemap: " + s.URL + "/private.xml\n"))
+		case "/sitemap.xml":
+			w.Write([]byte(`<urlset><url><loc>` + s.URL + `/</loc><priority>1.0</priority></url></urlset>`))
+		case "/private.xml":
+			w.Write([]byte(`<urlset><url><loc>` + s.URL + `/private</loc></url></urlset>`))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+		}
+	}))
+	defer s.Close()
+
+	c, err := New(WithSitemaps(), WithRobotsTxt("testbot"))
+	r.NoError(err)
+
+	responses := make(map[string]*Response)
+	err = c.Crawl(s.URL+"/", func(url string, res *Response, err error) error {
+		r.NoError(err)
+		responses[url] = res
+		return nil
+	})
+	r.NoError(err)
+
+	// sitemaps disallowed by robots.txt are not fetched
+	_, ok := requested.Load("/private.xml")
+	r.False(ok)
+	r.Len(responses, 1)
+
+	// the start URL gets its entry from the sitemap
+	r.Equal(&SitemapURL{Loc: s.URL + "/", Priority: "1.0"}, responses[s.URL+"/"].Sitemap)
+}
@@ -0,0 +1,294 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Formats of structured data
+const (
+	// JSONLD is data from <script type="application/ld+json">
+	JSONLD = "json-ld"
+
+	// Microdata is data from itemscope and itemprop attributes
+	Microdata = "microdata"
+
+	// RDFa is data from typeof and property attributes
+	RDFa = "rdfa"
+)
+
+// StructuredData is a block of structured data embedded in a page, such as
+// schema.org descriptions
+type StructuredData struct {
+	// Format of the data: JSONLD, Microdata or RDFa
+	Format string `json:"format"`
+
+	// JSON has the parsed JSON-LD document
+	JSON interface{} `json:"json,omitempty"`
+
+	// Item has the top level microdata or RDFa item
+	Item *Item `json:"item,omitempty"`
+
+	// Line and Column are where the element with the data starts in the
+	// document, starting at one. They are zero when the position is unknown.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+
+	// Error describes why the data could not be parsed
+	Error string `json:"error,omitempty"`
+}
+
+// Item is a microdata or RDFa item
+type Item struct {
+	// Type has the types of the item. e.g: https://schema.org/Product
+	Type []string `json:"type,omitempty"`
+
+	// ID is the global identifier of the item, from the itemid attribute in
+	// microdata and the about or resource attributes in RDFa
+	ID string `json:"id,omitempty"`
+
+	// Properties of the item by name. Values are either strings or *Item
+	Properties map[string][]interface{} `json:"properties"`
+}
+
+func (it *Item) add(name string, v interface{}) {
+	it.Properties[name] = append(it.Properties[name], v)
+}
+
+// isStructuredData reports whether an element starts a block of structured
+// data or an item within one
+func isStructuredData(tag string, attr []html.Attribute) bool {
+	for _, a := range attr {
+		switch {
+		case a.Key == "itemscope", a.Key == "typeof":
+			return true
+		case tag == "script" && a.Key == "type":
+			if isJSONLD(a.Val) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isJSONLD(typ string) bool {
+	typ = strings.TrimSpace(strings.ToLower(typ))
+	if i := strings.IndexByte(typ, ';'); i >= 0 {
+		typ = strings.TrimSpace(typ[:i])
+	}
+	return typ == "application/ld+json"
+}
+
+// extractStructuredData adds the structured data starting at the node to
+// the response. Nested items are added to the properties of their parents.
+func extractStructuredData(base *url.URL, n *html.Node, positions *sourcePositions, res *Response) {
+	if n.Type != html.ElementNode {
+		return
+	}
+	var data StructuredData
+	switch {
+	case n.Data == "script" && isJSONLD(attrValue(n, "type")):
+		data.Format = JSONLD
+		data.JSON, data.Error = parseJSONLD(nodeRawText(n))
+	case hasAttr(n, "itemscope") && (!hasAttr(n, "itemprop") || !hasAncestorAttr(n, "itemscope")):
+		data.Format = Microdata
+		data.Item = microdataItem(base, n)
+	case hasAttr(n, "typeof") && (!hasAttr(n, "property") || !hasAncestorAttr(n, "typeof")):
+		data.Format = RDFa
+		data.Item = rdfaItem(base, n, rdfaVocab(n))
+	default:
+		return
+	}
+	data.Line, data.Column = positions.position(n)
+	res.StructuredData = append(res.StructuredData, data)
+}
+
+func parseJSONLD(text string) (interface{}, string) {
+	text = strings.TrimSpace(text)
+	// some sites wrap the data in HTML comments for old browsers
+	text = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(text, "<!--"), "-->"))
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err.Error()
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, "invalid character after top-level value"
+	}
+	return v, ""
+}
+
+func microdataItem(base *url.URL, n *html.Node) *Item {
+	item := &Item{
+		Type:       strings.Fields(attrValue(n, "itemtype")),
+		ID:         strings.TrimSpace(attrValue(n, "itemid")),
+		Properties: make(map[string][]interface{}),
+	}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			scope := hasAttr(c, "itemscope")
+			if names := strings.Fields(attrValue(c, "itemprop")); len(names) > 0 {
+				var v interface{}
+				if scope {
+					v = microdataItem(base, c)
+				} else {
+					v = microdataValue(base, c)
+				}
+				for _, name := range names {
+					item.add(name, v)
+				}
+			}
+			if !scope {
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	return item
+}
+
+// microdataValue returns the value of a property following the rules from
+// the microdata specification
+func microdataValue(base *url.URL, n *html.Node) string {
+	switch n.Data {
+	case "meta":
+		return attrValue(n, "content")
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		return resolveAttr(base, n, "src")
+	case "a", "area", "link":
+		return resolveAttr(base, n, "href")
+	case "object":
+		return resolveAttr(base, n, "data")
+	case "data", "meter":
+		return attrValue(n, "value")
+	case "time":
+		if hasAttr(n, "datetime") {
+			return attrValue(n, "datetime")
+		}
+	}
+	return nodeText(n)
+}
+
+// rdfaVocab returns the vocabulary in effect for the node
+func rdfaVocab(n *html.Node) string {
+	for ; n != nil; n = n.Parent {
+		if n.Type == html.ElementNode && hasAttr(n, "vocab") {
+			return strings.TrimSpace(attrValue(n, "vocab"))
+		}
+	}
+	return ""
+}
+
+func rdfaItem(base *url.URL, n *html.Node, vocab string) *Item {
+	if hasAttr(n, "vocab") {
+		vocab = strings.TrimSpace(attrValue(n, "vocab"))
+	}
+	item := &Item{
+		ID:         strings.TrimSpace(attrValue(n, "about")),
+		Properties: make(map[string][]interface{}),
+	}
+	if item.ID == "" {
+		item.ID = strings.TrimSpace(attrValue(n, "resource"))
+	}
+	for _, typ := range strings.Fields(attrValue(n, "typeof")) {
+		// terms without a prefix belong to the vocabulary
+		if vocab != "" && !strings.Contains(typ, ":") {
+			typ = vocab + typ
+		}
+		item.Type = append(item.Type, typ)
+	}
+	var walk func(*html.Node, string)
+	walk = func(n *html.Node, vocab string) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			cvocab := vocab
+			if hasAttr(c, "vocab") {
+				cvocab = strings.TrimSpace(attrValue(c, "vocab"))
+			}
+			typed := hasAttr(c, "typeof")
+			if names := strings.Fields(attrValue(c, "property")); len(names) > 0 {
+				var v interface{}
+				if typed {
+					v = rdfaItem(base, c, cvocab)
+				} else {
+					v = rdfaValue(base, c)
+				}
+				for _, name := range names {
+					item.add(name, v)
+				}
+			}
+			if !typed {
+				walk(c, cvocab)
+			}
+		}
+	}
+	walk(n, vocab)
+	return item
+}
+
+func rdfaValue(base *url.URL, n *html.Node) string {
+	switch {
+	case hasAttr(n, "content"):
+		return attrValue(n, "content")
+	case hasAttr(n, "resource"):
+		return strings.TrimSpace(attrValue(n, "resource"))
+	case hasAttr(n, "href"):
+		return resolveAttr(base, n, "href")
+	case hasAttr(n, "src"):
+		return resolveAttr(base, n, "src")
+	case n.Data == "time" && hasAttr(n, "datetime"):
+		return attrValue(n, "datetime")
+	}
+	return nodeText(n)
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAncestorAttr(n *html.Node, key string) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && hasAttr(p, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveAttr returns the URL in the attribute resolved against base, or the
+// attribute as is when it is not a valid URL
+func resolveAttr(base *url.URL, n *html.Node, key string) string {
+	val := strings.TrimSpace(attrValue(n, key))
+	v, err := url.Parse(val)
+	if err != nil || val == "" {
+		return val
+	}
+	return base.ResolveReference(v).String()
+}
+
+// nodeRawText returns the text within the node as is
+func nodeRawText(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	return b.String()
+}
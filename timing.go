@@ -0,0 +1,90 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing has the breakdown of the time spent fetching a URL
+type Timing struct {
+	// DNS is the time spent resolving the host
+	DNS time.Duration `json:"dns"`
+
+	// Connect is the time spent establishing the TCP connection
+	Connect time.Duration `json:"connect"`
+
+	// TLS is the time spent on the TLS handshake
+	TLS time.Duration `json:"tls"`
+
+	// TTFB is the time from starting the request until the first byte of the
+	// response was received
+	TTFB time.Duration `json:"ttfb"`
+
+	// Total is the time from starting the request until the body was read
+	Total time.Duration `json:"total"`
+}
+
+// timingTrace collects the timing of a request through httptrace. Reused
+// connections report zero DNS, connect and TLS times.
+type timingTrace struct {
+	mut                    sync.Mutex
+	start                  time.Time
+	dnsStart, connectStart time.Time
+	tlsStart               time.Time
+	timing                 Timing
+}
+
+func newTimingTrace() *timingTrace {
+	return &timingTrace{start: time.Now()}
+}
+
+func (t *timingTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mut.Lock()
+			t.dnsStart = time.Now()
+			t.mut.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mut.Lock()
+			t.timing.DNS = time.Since(t.dnsStart)
+			t.mut.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			t.mut.Lock()
+			t.connectStart = time.Now()
+			t.mut.Unlock()
+		},
+		ConnectDone: func(string, string, error) {
+			t.mut.Lock()
+			t.timing.Connect = time.Since(t.connectStart)
+			t.mut.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mut.Lock()
+			t.tlsStart = time.Now()
+			t.mut.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mut.Lock()
+			t.timing.TLS = time.Since(t.tlsStart)
+			t.mut.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mut.Lock()
+			t.timing.TTFB = time.Since(t.start)
+			t.mut.Unlock()
+		},
+	}
+}
+
+// done returns the timing of the request once its body has been read
+func (t *timingTrace) done() *Timing {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	timing := t.timing
+	timing.Total = time.Since(t.start)
+	return &timing
+}
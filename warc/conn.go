@@ -0,0 +1,124 @@
+package warc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+)
+
+// maxHead is the size up to which the head of a response is kept as
+// received. Bigger heads are rebuilt from the parsed response.
+const maxHead = 64 << 10
+
+// headTransport returns a copy of t whose connections keep the head of the
+// responses as received, speaking HTTP/1.1 since HTTP/2 has no raw heads
+func headTransport(t *http.Transport) *http.Transport {
+	t = t.Clone()
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &headConn{Conn: conn}, nil
+	}
+
+	dialTLS := t.DialTLSContext
+	if dialTLS == nil {
+		dialTLS = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			cfg := &tls.Config{}
+			if t.TLSClientConfig != nil {
+				cfg = t.TLSClientConfig.Clone()
+			}
+			if cfg.ServerName == "" {
+				cfg.ServerName, _, _ = net.SplitHostPort(addr)
+			}
+			cfg.NextProtos = []string{"http/1.1"}
+			if t.TLSHandshakeTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, t.TLSHandshakeTimeout)
+				defer cancel()
+			}
+			// report the handshake like the http.Transport does when it
+			// dials the connection itself
+			trace := httptrace.ContextClientTrace(ctx)
+			if trace != nil && trace.TLSHandshakeStart != nil {
+				trace.TLSHandshakeStart()
+			}
+			tc := tls.Client(conn, cfg)
+			err = tc.HandshakeContext(ctx)
+			if trace != nil && trace.TLSHandshakeDone != nil {
+				trace.TLSHandshakeDone(tc.ConnectionState(), err)
+			}
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tc, nil
+		}
+	}
+	t.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialTLS(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &headConn{Conn: conn}, nil
+	}
+	t.ForceAttemptHTTP2 = false
+	t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	return t
+}
+
+// headConn is a connection keeping the head of the last response read from
+// it
+type headConn struct {
+	net.Conn
+
+	mut  sync.Mutex
+	head []byte
+	done bool
+}
+
+func (c *headConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if n > 0 && !c.done {
+		c.head = append(c.head, p[:n]...)
+		if i := bytes.Index(c.head, []byte("\r\n\r\n")); i >= 0 {
+			c.head, c.done = c.head[:i+4], true
+		} else if len(c.head) > maxHead {
+			c.head, c.done = nil, true
+		}
+	}
+	return n, err
+}
+
+// reset starts keeping the head of the next response, called before sending
+// each request
+func (c *headConn) reset() {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.head, c.done = nil, false
+}
+
+// response returns the head of the response read, or nil if it was not kept
+func (c *headConn) response() []byte {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if !c.done {
+		return nil
+	}
+	return c.head
+}
@@ -0,0 +1,49 @@
+package warc
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ernesto-jimenez/crawler"
+)
+
+// CrawlFunc wraps fn writing a metadata record for every page crawled before
+// calling fn
+func (w *Writer) CrawlFunc(fn crawler.CrawlFunc) crawler.CrawlFunc {
+	return func(url string, res *crawler.Response, err error) error {
+		if err == nil && res != nil {
+			if err := w.WriteMetadata(res); err != nil {
+				return err
+			}
+		}
+		return fn(url, res, err)
+	}
+}
+
+// WriteMetadata writes a metadata record with the links, assets and redirect
+// found in the response, referring to the response record of its URL
+func (w *Writer) WriteMetadata(res *crawler.Response) error {
+	var block bytes.Buffer
+	if res.RedirectTo != "" {
+		fmt.Fprintf(&block, "redirect: %s\r\n", res.RedirectTo)
+	}
+	for _, link := range res.Links {
+		fmt.Fprintf(&block, "outlink: %s\r\n", link.URL)
+	}
+	for _, asset := range res.Assets {
+		fmt.Fprintf(&block, "embed: %s %s\r\n", asset.URL, asset.Tag)
+	}
+	if res.Timing != nil {
+		fmt.Fprintf(&block, "fetchTimeMs: %d\r\n", res.Timing.Total.Milliseconds())
+	}
+
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	r := w.newRecord("metadata", res.URL, w.now(), block.Bytes())
+	if ref, ok := w.responses.get(res.URL); ok {
+		r.add("WARC-Concurrent-To", ref.id)
+		w.responses.delete(res.URL)
+	}
+	r.add("Content-Type", "application/warc-fields")
+	return w.write(r)
+}
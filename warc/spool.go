@@ -0,0 +1,66 @@
+package warc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// spoolMemory is the size up to which bodies are held in memory while being
+// recorded. Bigger bodies are written to a temporary file.
+const spoolMemory = 1 << 20
+
+// spool holds a body while it is recorded, in memory while small and in a
+// temporary file once it grows over spoolMemory
+type spool struct {
+	buf  bytes.Buffer
+	file *os.File
+	size int64
+}
+
+func (s *spool) Write(p []byte) (int, error) {
+	if s.file == nil && s.buf.Len()+len(p) > spoolMemory {
+		f, err := ioutil.TempFile("", "warc-body-")
+		if err != nil {
+			return 0, err
+		}
+		s.file = f
+		if _, err := f.Write(s.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		s.buf = bytes.Buffer{}
+	}
+	var (
+		n   int
+		err error
+	)
+	if s.file == nil {
+		n, err = s.buf.Write(p)
+	} else {
+		n, err = s.file.Write(p)
+	}
+	s.size += int64(n)
+	return n, err
+}
+
+// reader returns a new reader for the data written
+func (s *spool) reader() io.Reader {
+	if s.file == nil {
+		return bytes.NewReader(s.buf.Bytes())
+	}
+	return io.NewSectionReader(s.file, 0, s.size)
+}
+
+// Close removes the temporary file, if any
+func (s *spool) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	if rerr := os.Remove(s.file.Name()); err == nil {
+		err = rerr
+	}
+	s.file = nil
+	return err
+}
@@ -0,0 +1,271 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"strings"
+	"time"
+)
+
+// transport records the requests sent and the responses received
+type transport struct {
+	rt http.RoundTripper
+	w  *Writer
+}
+
+// NewTransport wraps rt recording every request and response in w. The
+// response is recorded as received, before being decompressed, and payloads
+// already recorded are written as revisit records. When rt is an
+// *http.Transport, a copy of it speaking HTTP/1.1 is used to record the
+// status line and headers exactly as received, which leaves the TLS field of
+// the responses empty.
+//
+// The body is recorded as it is read, so only the part read by the client is
+// archived, and the records are written once the body is closed. Bodies
+// closed before reaching their end are marked with WARC-Truncated. Bodies are
+// held in memory while small and in a temporary file otherwise.
+func NewTransport(rt http.RoundTripper, w *Writer) http.RoundTripper {
+	if t, ok := rt.(*http.Transport); ok {
+		rt = headTransport(t)
+	}
+	return &transport{rt: rt, w: w}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	// ask for gzip explicitly so the transport keeps the body compressed,
+	// like the http.Transport would do it transparently otherwise
+	decompress := false
+	if out.Method != http.MethodHead && out.Header.Get("Accept-Encoding") == "" && out.Header.Get("Range") == "" {
+		out.Header.Set("Accept-Encoding", "gzip")
+		decompress = true
+	}
+	ex := &exchange{uri: out.URL.String(), date: t.w.now()}
+	var conn *headConn
+	out = out.WithContext(httptrace.WithClientTrace(out.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if addr, ok := info.Conn.RemoteAddr().(*net.TCPAddr); ok {
+				ex.ip = addr.IP.String()
+			}
+			if c, ok := info.Conn.(*headConn); ok {
+				c.reset()
+				conn = c
+			}
+		},
+	}))
+
+	res, err := t.rt.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	if ex.request, err = httputil.DumpRequestOut(out, false); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	if conn != nil {
+		ex.head = conn.response()
+	}
+	if !isHead(ex.head, res) {
+		if ex.head, err = responseHead(res); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+	}
+	for _, te := range res.TransferEncoding {
+		ex.chunked = ex.chunked || te == "chunked"
+	}
+	body := &recordingBody{
+		body:    res.Body,
+		payload: &spool{},
+		hash:    sha1.New(),
+		eof:     res.Body == http.NoBody,
+		record: func(payload *spool, payloadDigest string, truncated bool) error {
+			err := t.w.writeExchange(ex, payload, payloadDigest, truncated)
+			if err != nil {
+				t.w.fail(err)
+			}
+			return err
+		},
+	}
+	res.Body = body
+	if decompress && res.Header.Get("Content-Encoding") == "gzip" {
+		res.Body = &gzipBody{body: body}
+		res.Header.Del("Content-Encoding")
+		res.Header.Del("Content-Length")
+		res.ContentLength = -1
+		res.Uncompressed = true
+	}
+	return res, nil
+}
+
+// exchange is a request and the response received, recorded once its body
+// is closed
+type exchange struct {
+	uri     string
+	ip      string
+	date    time.Time
+	request []byte
+
+	// head is the status line and headers of the response
+	head []byte
+
+	// chunked is whether the head has Transfer-Encoding: chunked, which
+	// was removed from the payload and is added back when recorded
+	chunked bool
+}
+
+// isHead returns whether head is the head kept for the response, which is
+// not the case for interim responses or connections not keeping heads
+func isHead(head []byte, res *http.Response) bool {
+	return bytes.HasPrefix(head, []byte(fmt.Sprintf("%s %03d", res.Proto, res.StatusCode)))
+}
+
+// responseHead rebuilds the status line and headers of the response, used
+// when they were not kept as received
+func responseHead(res *http.Response) ([]byte, error) {
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "%s %s\r\n", res.Proto, res.Status)
+	if len(res.TransferEncoding) > 0 {
+		fmt.Fprintf(&head, "Transfer-Encoding: %s\r\n", strings.Join(res.TransferEncoding, ", "))
+	}
+	if err := res.Header.Write(&head); err != nil {
+		return nil, err
+	}
+	head.WriteString("\r\n")
+	return head.Bytes(), nil
+}
+
+// recordingBody records the body of a response as it is read, writing the
+// records once closed
+type recordingBody struct {
+	body    io.ReadCloser
+	payload *spool
+	hash    hash.Hash
+	eof     bool
+	err     error
+	record  func(payload *spool, payloadDigest string, truncated bool) error
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 && b.err == nil {
+		b.hash.Write(p[:n])
+		if _, werr := b.payload.Write(p[:n]); werr != nil {
+			b.err = werr
+		}
+	}
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.body.Close()
+	defer b.payload.Close()
+	if b.err != nil {
+		return b.err
+	}
+	if b.record == nil {
+		return err
+	}
+	rerr := b.record(b.payload, sumDigest(b.hash), !b.eof)
+	b.record = nil
+	if rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+// gzipBody decompresses the body, created on the first read so closing an
+// unread body does not read it
+type gzipBody struct {
+	body io.ReadCloser
+	gz   *gzip.Reader
+	err  error
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.gz == nil && b.err == nil {
+		b.gz, b.err = gzip.NewReader(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.gz.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
+
+// writeExchange writes the request record along with the response or
+// revisit record
+func (w *Writer) writeExchange(ex *exchange, payload *spool, payloadDigest string, truncated bool) error {
+	empty := payload.size == 0
+	// chunked payloads are recorded as a single chunk, ending it when the
+	// whole body was read
+	var chunk, end []byte
+	if ex.chunked && !empty {
+		chunk = []byte(fmt.Sprintf("%x\r\n", payload.size))
+		end = []byte("\r\n")
+	}
+	if ex.chunked && !truncated {
+		end = append(end, "0\r\n\r\n"...)
+	}
+	block := func() io.Reader {
+		return io.MultiReader(bytes.NewReader(ex.head), bytes.NewReader(chunk), payload.reader(), bytes.NewReader(end))
+	}
+	blockHash := sha1.New()
+	if _, err := io.Copy(blockHash, block()); err != nil {
+		return err
+	}
+	uri, date := ex.uri, ex.date
+
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	var resRecord *record
+	if orig, ok := w.payloads.get(payloadDigest); ok && !empty && !truncated {
+		resRecord = w.newRecord("revisit", uri, date, ex.head)
+		resRecord.add("WARC-Profile", revisitProfile)
+		resRecord.add("WARC-Refers-To", orig.id)
+		resRecord.add("WARC-Refers-To-Target-URI", orig.uri)
+		resRecord.add("WARC-Refers-To-Date", orig.date)
+	} else {
+		resRecord = w.newRecord("response", uri, date, nil)
+		resRecord.setBlock(block(), int64(len(ex.head)+len(chunk)+len(end))+payload.size, sumDigest(blockHash))
+		if truncated {
+			resRecord.add("WARC-Truncated", "length")
+		}
+	}
+	if ex.ip != "" {
+		resRecord.add("WARC-IP-Address", ex.ip)
+	}
+	resRecord.add("WARC-Payload-Digest", payloadDigest)
+	resRecord.add("Content-Type", "application/http;msgtype=response")
+
+	reqRecord := w.newRecord("request", uri, date, ex.request)
+	reqRecord.add("WARC-Concurrent-To", resRecord.id)
+	if ex.ip != "" {
+		reqRecord.add("WARC-IP-Address", ex.ip)
+	}
+	reqRecord.add("Content-Type", "application/http;msgtype=request")
+
+	if err := w.write(reqRecord, resRecord); err != nil {
+		return err
+	}
+	if resRecord.typ == "response" && !empty && !truncated {
+		w.payloads.set(payloadDigest, recordRef{id: resRecord.id, uri: uri, date: resRecord.date})
+	}
+	w.responses.set(uri, recordRef{id: resRecord.id, uri: uri, date: resRecord.date})
+	return nil
+}
@@ -0,0 +1,392 @@
+// Package warc writes the requests and responses of a crawl as WARC/1.1
+// files, the format used by web archives.
+//
+// Requests and responses are recorded by wrapping the HTTP transport of the
+// crawler with NewTransport, while Writer.CrawlFunc records the links found
+// in each page as metadata records:
+//
+//	w, err := warc.NewWriter("archive")
+//	...
+//	defer w.Close()
+//	cr, err := crawler.New(crawler.WithHTTPTransport(warc.NewTransport(http.DefaultTransport, w)))
+//	...
+//	err = cr.Crawl(startURL, w.CrawlFunc(fn))
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultMaxFileSize is the size after which a new file is started
+	// unless WithMaxFileSize is used
+	defaultMaxFileSize = 1 << 30
+
+	// defaultPrefix is the prefix of the file names unless WithPrefix is
+	// used
+	defaultPrefix = "crawl"
+
+	// revisitProfile is the profile of the revisit records written for
+	// payloads already in the archive
+	revisitProfile = "http://netpreserve.org/warc/1.1/revisit/identical-payload-digest"
+
+	// maxRecent is the number of payloads and responses remembered to write
+	// revisit and metadata records, forgetting the oldest ones after that
+	maxRecent = 100000
+)
+
+// Option is used to provide optional configuration to a Writer
+type Option func(*Writer) error
+
+// WithMaxFileSize sets the size in bytes after which the writer starts a new
+// file. Records are never split, so files can be slightly bigger.
+func WithMaxFileSize(n int64) Option {
+	return func(w *Writer) error {
+		if n <= 0 {
+			return errors.Errorf("max file size must be positive. was: %d", n)
+		}
+		w.maxSize = n
+		return nil
+	}
+}
+
+// WithPrefix sets the prefix of the names of the files written
+func WithPrefix(prefix string) Option {
+	return func(w *Writer) error {
+		if prefix == "" || filepath.Base(prefix) != prefix {
+			return errors.Errorf("invalid file prefix %q", prefix)
+		}
+		w.prefix = prefix
+		return nil
+	}
+}
+
+// WithoutCompression writes plain .warc files instead of compressing each
+// record with gzip
+func WithoutCompression() Option {
+	return func(w *Writer) error {
+		w.compress = false
+		return nil
+	}
+}
+
+// WithSoftware sets the software described in the warcinfo record at the
+// start of each file
+func WithSoftware(software string) Option {
+	return func(w *Writer) error {
+		w.software = software
+		return nil
+	}
+}
+
+// Writer writes WARC records to files in a directory, starting a new file
+// whenever the current one reaches the max file size. It is safe for
+// concurrent use.
+type Writer struct {
+	dir      string
+	prefix   string
+	maxSize  int64
+	compress bool
+	software string
+
+	mut     sync.Mutex
+	file    *os.File
+	size    int64
+	seq     int
+	started string
+
+	// payloads has the first response of each payload digest, used to write
+	// revisit records for duplicates
+	payloads *recent
+
+	// responses has the last response record of each URL, referenced from
+	// the metadata records and forgotten once the metadata is written
+	responses *recent
+
+	// err is the first error recording a response, which happens when its
+	// body is closed and is returned again by Close
+	err error
+
+	now func() time.Time
+}
+
+type recordRef struct {
+	id   string
+	uri  string
+	date string
+}
+
+// recent holds the references to the records written last, forgetting the
+// oldest ones once it holds max of them
+type recent struct {
+	max   int
+	refs  map[string]*list.Element
+	order *list.List
+}
+
+type recentRef struct {
+	key string
+	ref recordRef
+}
+
+func newRecent(max int) *recent {
+	return &recent{max: max, refs: make(map[string]*list.Element), order: list.New()}
+}
+
+func (r *recent) get(key string) (recordRef, bool) {
+	if e, ok := r.refs[key]; ok {
+		return e.Value.(*recentRef).ref, true
+	}
+	return recordRef{}, false
+}
+
+func (r *recent) set(key string, ref recordRef) {
+	r.delete(key)
+	r.refs[key] = r.order.PushBack(&recentRef{key: key, ref: ref})
+	for r.order.Len() > r.max {
+		r.delete(r.order.Front().Value.(*recentRef).key)
+	}
+}
+
+func (r *recent) delete(key string) {
+	if e, ok := r.refs[key]; ok {
+		r.order.Remove(e)
+		delete(r.refs, key)
+	}
+}
+
+// NewWriter creates a writer storing the WARC files in dir, which is created
+// if needed
+func NewWriter(dir string, opts ...Option) (*Writer, error) {
+	w := &Writer{
+		dir:       dir,
+		prefix:    defaultPrefix,
+		maxSize:   defaultMaxFileSize,
+		compress:  true,
+		software:  "github.com/ernesto-jimenez/crawler",
+		payloads:  newRecent(maxRecent),
+		responses: newRecent(maxRecent),
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		if err := opt(w); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w.started = w.now().UTC().Format("20060102150405")
+	return w, nil
+}
+
+// Close closes the current file, returning the first error recording a
+// response if any
+func (w *Writer) Close() error {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if w.file == nil {
+		return w.err
+	}
+	err := w.file.Close()
+	w.file = nil
+	if w.err != nil {
+		return w.err
+	}
+	return err
+}
+
+// fail keeps err to be returned by Close unless there was an error already
+func (w *Writer) fail(err error) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// record is a WARC record before being written
+type record struct {
+	typ    string
+	uri    string
+	id     string
+	date   string
+	fields []field
+	block  io.Reader
+	length int64
+	digest string
+}
+
+type field struct {
+	name, value string
+}
+
+func (w *Writer) newRecord(typ, uri string, date time.Time, block []byte) *record {
+	r := &record{
+		typ:  typ,
+		uri:  uri,
+		id:   newRecordID(),
+		date: date.UTC().Format(time.RFC3339),
+	}
+	r.setBlock(bytes.NewReader(block), int64(len(block)), digest(sha1.New(), block))
+	return r
+}
+
+// setBlock sets the content of the record, read when the record is written
+func (r *record) setBlock(block io.Reader, length int64, blockDigest string) {
+	r.block = block
+	r.length = length
+	r.digest = blockDigest
+}
+
+func (r *record) add(name, value string) {
+	r.fields = append(r.fields, field{name, value})
+}
+
+// writeTo writes the record serialised as WARC/1.1
+func (r *record) writeTo(out io.Writer) error {
+	b := bufio.NewWriter(out)
+	b.WriteString("WARC/1.1\r\n")
+	fmt.Fprintf(b, "WARC-Type: %s\r\n", r.typ)
+	fmt.Fprintf(b, "WARC-Record-ID: %s\r\n", r.id)
+	fmt.Fprintf(b, "WARC-Date: %s\r\n", r.date)
+	if r.uri != "" {
+		fmt.Fprintf(b, "WARC-Target-URI: %s\r\n", r.uri)
+	}
+	for _, f := range r.fields {
+		fmt.Fprintf(b, "%s: %s\r\n", f.name, f.value)
+	}
+	fmt.Fprintf(b, "WARC-Block-Digest: %s\r\n", r.digest)
+	fmt.Fprintf(b, "Content-Length: %d\r\n", r.length)
+	b.WriteString("\r\n")
+	if _, err := io.Copy(b, r.block); err != nil {
+		return err
+	}
+	b.WriteString("\r\n\r\n")
+	return b.Flush()
+}
+
+// write appends the records to the current file, keeping them together. It
+// must be called with the mutex held.
+func (w *Writer) write(records ...*record) error {
+	if w.file == nil || w.size >= w.maxSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	for _, r := range records {
+		if err := w.writeRecord(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) writeRecord(r *record) error {
+	out := &countingWriter{w: w.file}
+	defer func() { w.size += out.n }()
+	if !w.compress {
+		return r.writeTo(out)
+	}
+	// every record is a gzip member on its own so records can be read
+	// without decompressing the whole file
+	gz := gzip.NewWriter(out)
+	if err := r.writeTo(gz); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// rotate closes the current file and starts a new one with a warcinfo
+// record
+func (w *Writer) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+	ext := ".warc"
+	if w.compress {
+		ext += ".gz"
+	}
+	name := fmt.Sprintf("%s-%s-%05d%s", w.prefix, w.started, w.seq, ext)
+	f, err := os.OpenFile(filepath.Join(w.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	w.seq++
+	w.file = f
+	w.size = 0
+
+	info := w.newRecord("warcinfo", "", w.now(), []byte(fmt.Sprintf(
+		"software: %s\r\nformat: WARC File Format 1.1\r\nconformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n",
+		w.software,
+	)))
+	info.add("WARC-Filename", name)
+	info.add("Content-Type", "application/warc-fields")
+	return w.writeRecord(info)
+}
+
+// Files returns the paths of the files written so far
+func (w *Writer) Files() []string {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	ext := ".warc"
+	if w.compress {
+		ext += ".gz"
+	}
+	files := make([]string, 0, w.seq)
+	for i := 0; i < w.seq; i++ {
+		files = append(files, filepath.Join(w.dir, fmt.Sprintf("%s-%s-%05d%s", w.prefix, w.started, i, ext)))
+	}
+	return files
+}
+
+// digest returns the labelled base32 digest used in WARC headers
+func digest(h hash.Hash, data []byte) string {
+	h.Write(data)
+	return sumDigest(h)
+}
+
+// sumDigest returns the labelled base32 digest of the data written to h
+func sumDigest(h hash.Hash) string {
+	return "sha1:" + base32.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func newRecordID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
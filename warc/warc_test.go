@@ -0,0 +1,412 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ernesto-jimenez/crawler"
+	"github.com/stretchr/testify/require"
+)
+
+type testRecord struct {
+	header textproto.MIMEHeader
+	block  []byte
+}
+
+// readRecords reads all the records from a WARC file
+func readRecords(t *testing.T, path string, compressed bool) []testRecord {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var r io.Reader = f
+	if compressed {
+		gz, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		r = gz
+	}
+	br := bufio.NewReader(r)
+	var records []testRecord
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			return records
+		}
+		require.NoError(t, err)
+		require.Equal(t, "WARC/1.1\r\n", line)
+		header, err := textproto.NewReader(br).ReadMIMEHeader()
+		require.NoError(t, err)
+		n, err := strconv.Atoi(header.Get("Content-Length"))
+		require.NoError(t, err)
+		block := make([]byte, n)
+		_, err = io.ReadFull(br, block)
+		require.NoError(t, err)
+		end := make([]byte, 4)
+		_, err = io.ReadFull(br, end)
+		require.NoError(t, err)
+		require.Equal(t, "\r\n\r\n", string(end))
+		require.Equal(t, digest(sha1.New(), block), header.Get("WARC-Block-Digest"))
+		records = append(records, testRecord{header: header, block: block})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	r := require.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(strings.Repeat("compressed ", 100)))
+			gz.Close()
+		default:
+			w.Write([]byte("same payload"))
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "warc")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(dir)
+	r.NoError(err)
+	client := &http.Client{Transport: NewTransport(http.DefaultTransport, w)}
+
+	for _, path := range []string{"/a", "/b", "/gzip"} {
+		res, err := client.Get(ts.URL + path)
+		r.NoError(err)
+		body, err := ioutil.ReadAll(res.Body)
+		r.NoError(err)
+		res.Body.Close()
+		if path == "/gzip" {
+			r.Equal(strings.Repeat("compressed ", 100), string(body))
+			r.Empty(res.Header.Get("Content-Encoding"))
+		} else {
+			r.Equal("same payload", string(body))
+		}
+	}
+	r.NoError(w.Close())
+
+	files := w.Files()
+	r.Len(files, 1)
+	r.True(strings.HasSuffix(files[0], ".warc.gz"))
+	records := readRecords(t, files[0], true)
+
+	var types []string
+	for _, rec := range records {
+		types = append(types, rec.header.Get("WARC-Type"))
+	}
+	r.Equal([]string{"warcinfo", "request", "response", "request", "revisit", "request", "response"}, types)
+
+	req, res := records[1], records[2]
+	r.Equal(ts.URL+"/a", req.header.Get("WARC-Target-URI"))
+	r.Equal(res.header.Get("WARC-Record-ID"), req.header.Get("WARC-Concurrent-To"))
+	r.Equal("127.0.0.1", res.header.Get("WARC-IP-Address"))
+	r.True(strings.HasPrefix(string(req.block), "GET /a HTTP/1.1\r\n"))
+	r.True(strings.HasPrefix(string(res.block), "HTTP/1.1 200 OK\r\n"))
+	r.True(bytes.HasSuffix(res.block, []byte("\r\n\r\nsame payload")))
+	r.Equal(digest(sha1.New(), []byte("same payload")), res.header.Get("WARC-Payload-Digest"))
+
+	revisit := records[4]
+	r.Equal(ts.URL+"/b", revisit.header.Get("WARC-Target-URI"))
+	r.Equal(revisitProfile, revisit.header.Get("WARC-Profile"))
+	r.Equal(res.header.Get("WARC-Record-ID"), revisit.header.Get("WARC-Refers-To"))
+	r.Equal(ts.URL+"/a", revisit.header.Get("WARC-Refers-To-Target-URI"))
+	r.Equal(res.header.Get("WARC-Payload-Digest"), revisit.header.Get("WARC-Payload-Digest"))
+	r.True(bytes.HasSuffix(revisit.block, []byte("\r\n\r\n")))
+
+	// the response is recorded as received
+	gzRes := records[6]
+	r.Contains(string(gzRes.block), "Content-Encoding: gzip\r\n")
+	r.NotContains(string(gzRes.block), "compressed compressed")
+}
+
+func TestTransportLargeBody(t *testing.T) {
+	r := require.New(t)
+	dir, err := ioutil.TempDir("", "warc")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+	tmp, err := ioutil.TempDir("", "warc-tmp")
+	r.NoError(err)
+	defer os.RemoveAll(tmp)
+	t.Setenv("TMPDIR", tmp)
+
+	payload := bytes.Repeat([]byte("0123456789"), spoolMemory/5)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(payload)
+	}))
+	defer ts.Close()
+
+	w, err := NewWriter(dir, WithoutCompression())
+	r.NoError(err)
+	client := &http.Client{Transport: NewTransport(http.DefaultTransport, w)}
+
+	res, err := client.Get(ts.URL + "/large")
+	r.NoError(err)
+	body, err := ioutil.ReadAll(res.Body)
+	r.NoError(err)
+	// the body is spooled to a temporary file until closed
+	files, err := ioutil.ReadDir(tmp)
+	r.NoError(err)
+	r.Len(files, 1)
+	r.NoError(res.Body.Close())
+	r.Equal(payload, body)
+	files, err = ioutil.ReadDir(tmp)
+	r.NoError(err)
+	r.Empty(files)
+	r.NoError(w.Close())
+
+	records := readRecords(t, w.Files()[0], false)
+	r.Len(records, 3)
+	r.Equal("response", records[2].header.Get("WARC-Type"))
+	// the server sends the body chunked, which is recorded as one chunk
+	r.True(bytes.Contains(records[2].block, append([]byte(fmt.Sprintf("\r\n\r\n%x\r\n", len(payload))), payload...)))
+	r.True(bytes.HasSuffix(records[2].block, []byte("\r\n0\r\n\r\n")))
+	r.Equal(digest(sha1.New(), payload), records[2].header.Get("WARC-Payload-Digest"))
+}
+
+func TestTransportTruncated(t *testing.T) {
+	r := require.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(strings.Repeat("0123456789", 100)))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "warc")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(dir, WithoutCompression())
+	r.NoError(err)
+	client := &http.Client{Transport: NewTransport(http.DefaultTransport, w)}
+
+	for _, path := range []string{"/partial", "/unread"} {
+		res, err := client.Get(ts.URL + path)
+		r.NoError(err)
+		if path == "/partial" {
+			_, err = io.ReadFull(res.Body, make([]byte, 10))
+			r.NoError(err)
+		}
+		r.NoError(res.Body.Close())
+	}
+	r.NoError(w.Close())
+
+	// only the part of the body read is recorded
+	records := readRecords(t, w.Files()[0], false)
+	r.Len(records, 5)
+	partial, unread := records[2], records[4]
+	r.Equal("response", partial.header.Get("WARC-Type"))
+	r.Equal("length", partial.header.Get("WARC-Truncated"))
+	r.True(bytes.HasSuffix(partial.block, []byte("\r\n\r\n0123456789")))
+	r.Equal(digest(sha1.New(), []byte("0123456789")), partial.header.Get("WARC-Payload-Digest"))
+
+	r.Equal("response", unread.header.Get("WARC-Type"))
+	r.Equal("length", unread.header.Get("WARC-Truncated"))
+	r.True(bytes.HasSuffix(unread.block, []byte("\r\n\r\n")))
+}
+
+func TestTransportRawHead(t *testing.T) {
+	r := require.New(t)
+
+	const head = "HTTP/1.1 200 OK\r\nX-Second: 2\r\ncontent-type: text/plain\r\nTransfer-Encoding: chunked\r\nX-First: 1\r\n\r\n"
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	r.NoError(err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		for i := 0; i < 2; i++ {
+			if _, err := http.ReadRequest(br); err != nil {
+				return
+			}
+			conn.Write([]byte(head + "3\r\nhel\r\n2\r\nlo\r\n0\r\n\r\n"))
+		}
+	}()
+
+	dir, err := ioutil.TempDir("", "warc")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(dir, WithoutCompression())
+	r.NoError(err)
+	client := &http.Client{Transport: NewTransport(http.DefaultTransport, w)}
+
+	// the second request reuses the connection
+	for _, path := range []string{"/a", "/b"} {
+		res, err := client.Get("http://" + ln.Addr().String() + path)
+		r.NoError(err)
+		body, err := ioutil.ReadAll(res.Body)
+		r.NoError(err)
+		r.NoError(res.Body.Close())
+		r.Equal("hello", string(body))
+	}
+	r.NoError(w.Close())
+
+	records := readRecords(t, w.Files()[0], false)
+	r.Len(records, 5)
+	res := records[2]
+	r.Equal("response", res.header.Get("WARC-Type"))
+	r.Equal(head+"5\r\nhello\r\n0\r\n\r\n", string(res.block))
+	r.Equal(digest(sha1.New(), []byte("hello")), res.header.Get("WARC-Payload-Digest"))
+	revisit := records[4]
+	r.Equal("revisit", revisit.header.Get("WARC-Type"))
+	r.Equal(head, string(revisit.block))
+}
+
+func TestTransportTLS(t *testing.T) {
+	r := require.New(t)
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "warc")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(dir, WithoutCompression())
+	r.NoError(err)
+	client := &http.Client{Transport: NewTransport(ts.Client().Transport, w)}
+
+	res, err := client.Get(ts.URL + "/")
+	r.NoError(err)
+	body, err := ioutil.ReadAll(res.Body)
+	r.NoError(err)
+	r.NoError(res.Body.Close())
+	r.Equal("secure", string(body))
+	r.Equal(1, res.ProtoMajor)
+	r.NoError(w.Close())
+
+	records := readRecords(t, w.Files()[0], false)
+	r.Len(records, 3)
+	r.True(strings.HasPrefix(string(records[2].block), "HTTP/1.1 200 OK\r\n"))
+	r.True(bytes.HasSuffix(records[2].block, []byte("\r\n\r\nsecure")))
+}
+
+func TestRotation(t *testing.T) {
+	r := require.New(t)
+
+	dir, err := ioutil.TempDir("", "warc")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(dir, WithMaxFileSize(100), WithoutCompression(), WithPrefix("test"))
+	r.NoError(err)
+	for _, u := range []string{"http://example.com/a", "http://example.com/b"} {
+		r.NoError(w.WriteMetadata(&crawler.Response{
+			URL:   u,
+			Links: []crawler.Link{{URL: "http://example.com/"}},
+		}))
+	}
+	r.NoError(w.Close())
+
+	files := w.Files()
+	r.Len(files, 2)
+	for i, file := range files {
+		r.True(strings.HasSuffix(file, ".warc"))
+		records := readRecords(t, file, false)
+		r.Len(records, 2)
+		r.Equal("warcinfo", records[0].header.Get("WARC-Type"))
+		r.Equal("metadata", records[1].header.Get("WARC-Type"))
+		r.Equal([]string{"http://example.com/a", "http://example.com/b"}[i], records[1].header.Get("WARC-Target-URI"))
+		r.Equal("outlink: http://example.com/\r\n", string(records[1].block))
+	}
+}
+
+func TestCrawlFunc(t *testing.T) {
+	r := require.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/other">other</a><img src="/img.png">`))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "warc")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(dir)
+	r.NoError(err)
+	cr, err := crawler.New(
+		crawler.WithHTTPTransport(NewTransport(http.DefaultTransport, w)),
+		crawler.WithMaxDepth(1),
+	)
+	r.NoError(err)
+	var called bool
+	err = cr.Crawl(ts.URL+"/", w.CrawlFunc(func(url string, res *crawler.Response, err error) error {
+		called = true
+		return err
+	}))
+	r.NoError(err)
+	r.True(called)
+	r.NoError(w.Close())
+
+	records := readRecords(t, w.Files()[0], true)
+	var response, metadata *testRecord
+	for i, rec := range records {
+		if rec.header.Get("WARC-Target-URI") != ts.URL+"/" {
+			continue
+		}
+		switch rec.header.Get("WARC-Type") {
+		case "response":
+			response = &records[i]
+		case "metadata":
+			metadata = &records[i]
+		}
+	}
+	r.NotNil(response)
+	r.NotNil(metadata)
+	r.Equal(response.header.Get("WARC-Record-ID"), metadata.header.Get("WARC-Concurrent-To"))
+	r.Equal("application/warc-fields", metadata.header.Get("Content-Type"))
+	r.Contains(string(metadata.block), "outlink: "+ts.URL+"/other\r\n")
+	r.Contains(string(metadata.block), "embed: "+ts.URL+"/img.png img\r\n")
+
+	// the response is forgotten once its metadata is written
+	_, ok := w.responses.get(ts.URL + "/")
+	r.False(ok)
+}
+
+func TestRecent(t *testing.T) {
+	r := require.New(t)
+
+	refs := newRecent(2)
+	refs.set("a", recordRef{id: "1"})
+	refs.set("b", recordRef{id: "2"})
+	refs.set("a", recordRef{id: "3"})
+	refs.set("c", recordRef{id: "4"})
+
+	// b is the oldest after a was set again
+	_, ok := refs.get("b")
+	r.False(ok)
+	ref, ok := refs.get("a")
+	r.True(ok)
+	r.Equal("3", ref.id)
+	_, ok = refs.get("c")
+	r.True(ok)
+
+	refs.delete("a")
+	_, ok = refs.get("a")
+	r.False(ok)
+	r.Equal(1, refs.order.Len())
+}
@@ -1,13 +1,16 @@
 package crawler
 
 import (
+	"bufio"
 	"context"
 	"errors"
-	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
-	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -15,7 +18,11 @@ import (
 // CrawlFunc is the type of the function called for each webpage visited by
 // Crawl. The incoming url specifies which url was fetched, while res contains
 // the response of the fetched URL if it was successful. If the fetch failed,
-// the incoming error will specify the reason and res will be nil.
+// the incoming error will specify the reason and res will be nil, except for
+// *HTTPError where res has the status, headers and timing of the response.
+//
+// Fetch errors can be inspected with errors.As: *HTTPError, *DNSError,
+// *TLSError, *TimeoutError, *NetworkError and *DisallowedError.
 //
 // Returning ErrSkipURL will avoid queing up the resources links to be crawled.
 //
@@ -35,8 +42,18 @@ type Worker struct {
 	client     *http.Client
 	fn         CrawlFunc
 	checkFetch CheckFetchStack
+	assetCheck CheckFetchStack
+	countPage  func(err error)
 	maxRedirs  int
 	goroutines int
+	robots     *robotsCache
+	limiter    *hostLimiter
+	retry      *RetryPolicy
+	sitemaps   *sitemapDiscovery
+	directives bool
+	extractors []Extractor
+	assets     *assetFetcher
+	fetch      *fetchConfig
 }
 
 // NewWorker initialises a goroutine
@@ -54,20 +71,68 @@ func NewWorker(fn CrawlFunc, opts ...Option) (*Worker, error) {
 	if o.goroutines == 0 {
 		o.goroutines = 1
 	}
+	maxRedirs := defaultMaxRedirects
+	if o.maxRedirs != nil {
+		maxRedirs = *o.maxRedirs
+	}
 	var mut sync.Mutex
 
+	var (
+		robots   *robotsCache
+		limiter  *hostLimiter
+		sitemaps *sitemapDiscovery
+	)
+	if o.robotsTxt != "" {
+		robots = newRobotsCache(o.transport, o.robotsTxt)
+	}
+	if o.sitemaps {
+		// robots.txt is read for its Sitemap lines even when its rules are
+		// not enforced
+		sitemapRobots := robots
+		if sitemapRobots == nil {
+			sitemapRobots = newRobotsCache(o.transport, "")
+		}
+		sitemaps = newSitemapDiscovery(o.transport, sitemapRobots)
+	}
+	if o.robotsTxt != "" || o.hostRate > 0 {
+		limiter = newHostLimiter(o.hostRate, o.hostBurst)
+	}
+	parsers := make(map[string]ParseFunc, len(defaultParsers)+len(o.parsers))
+	for mt, parse := range defaultParsers {
+		parsers[mt] = parse
+	}
+	for mt, parse := range o.parsers {
+		parsers[mt] = parse
+	}
+
 	return &Worker{
 		client: &http.Client{
 			Transport:     o.transport,
 			CheckRedirect: skipRedirects,
 		},
 		checkFetch: CheckFetchStack(o.checkFetch),
+		assetCheck: CheckFetchStack(o.assetCheckFetch),
+		countPage:  o.countPage,
 		fn: func(url string, res *Response, err error) error {
 			mut.Lock()
 			defer mut.Unlock()
 			return fn(url, res, err)
 		},
+		maxRedirs:  maxRedirs,
 		goroutines: o.goroutines,
+		robots:     robots,
+		limiter:    limiter,
+		retry:      o.retryPolicy,
+		sitemaps:   sitemaps,
+		directives: o.directives,
+		extractors: o.extractors,
+		assets:     newAssetFetcher(o.assets),
+		fetch: &fetchConfig{
+			parsers:     parsers,
+			maxBodySize: o.maxBodySize,
+			keepBody:    o.keepBody,
+			userAgent:   o.robotsTxt,
+		},
 	}, nil
 }
 
@@ -83,39 +148,135 @@ func (w *Worker) run(ctx context.Context, q Queue) error {
 		if req == nil {
 			return nil
 		}
-		if !w.checkFetch.CheckFetch(req) {
+		// retried requests already passed the checks
+		if req.attempts == 0 && !w.checkFetch.CheckFetch(req) {
 			req.Finish()
 			continue
 		}
-		res, err := fetch(ctx, w.client, req)
+		if w.sitemaps != nil {
+			if err := w.sitemaps.discover(ctx, q, req, w.prepare); err != nil {
+				return err
+			}
+		}
+		var res *Response
+		err = w.prepare(ctx, req)
+		if err == nil {
+			res, err = fetch(ctx, w.client, req, w.fetch)
+		}
+		if err == nil {
+			err = w.extract(req, res)
+		}
+		if err == nil && w.assets != nil {
+			if err := w.fetchAssets(ctx, res, true); err != nil {
+				releaseBody(res)
+				return err
+			}
+		}
 		if err := ctx.Err(); err != nil {
+			releaseBody(res)
 			return err
 		}
+		if err == nil && res.RedirectTo != "" {
+			err = checkRedirect(req, res, w.maxRedirs)
+		}
+		if err != nil && w.retry != nil {
+			if delay, ok := w.retry.retryable(req, err); ok {
+				releaseBody(res)
+				w.scheduleRetry(q, req, delay)
+				continue
+			}
+		}
+		if err != nil && req.attempts > 0 {
+			err = &RetryError{Attempts: req.attempts + 1, Err: err}
+		}
 		// call the CrawlFunc for each fetched url
-		// note this err is scoped to the if and does not override the previous declaration
-		if err := w.fn(req.URL.String(), res, err); err == ErrSkipURL {
+		if w.countPage != nil {
+			w.countPage(err)
+		}
+		fnErr := w.fn(req.URL.String(), res, err)
+		releaseBody(res)
+		if fnErr == ErrSkipURL {
 			req.Finish()
 			continue
-		} else if err != nil {
-			return err
+		} else if fnErr != nil {
+			return fnErr
 		}
 		// continue if there was an error crawlking
 		if err != nil {
 			req.Finish()
 			continue
 		}
-		if req, err := nextRequest(res, res.RedirectTo); err == nil {
-			q.PushBack(req)
+		if next, err := nextRequest(res, res.RedirectTo, true); err == nil {
+			if err := q.PushBack(next); err != nil {
+				return err
+			}
 		}
 		for _, link := range res.Links {
-			if req, err := nextRequest(res, link.URL); err == nil {
-				q.PushBack(req)
+			if w.directives && (link.NoFollow() || (res.Robots != nil && res.Robots.NoFollow)) {
+				continue
+			}
+			if next, err := nextRequest(res, link.URL, false); err == nil {
+				if err := q.PushBack(next); err != nil {
+					return err
+				}
 			}
 		}
 		req.Finish()
 	}
 }
 
+// prepare checks whether robots.txt allows the request and waits until its
+// host allows a new request
+func (w *Worker) prepare(ctx context.Context, req *Request) error {
+	if err := w.checkRobots(ctx, req); err != nil {
+		return err
+	}
+	return w.throttle(ctx, req)
+}
+
+func (w *Worker) checkRobots(ctx context.Context, req *Request) error {
+	if w.robots == nil {
+		return nil
+	}
+	ok, err := w.robots.allowed(ctx, req)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &DisallowedError{FetchError{
+			URL:     req.URL.String(),
+			Request: req,
+			Err:     ErrDisallowedByRobots,
+		}}
+	}
+	return nil
+}
+
+func (w *Worker) throttle(ctx context.Context, req *Request) error {
+	if w.limiter == nil {
+		return nil
+	}
+	var crawlDelay time.Duration
+	if w.robots != nil {
+		rules, err := w.robots.rules(ctx, req.URL)
+		if err != nil {
+			return err
+		}
+		crawlDelay = rules.crawlDelay
+	}
+	return w.limiter.wait(ctx, req.URL.Host, crawlDelay)
+}
+
+// HostDelay returns the minimum time the worker waits between requests to the
+// given host, taking into account WithHostRateLimit and the Crawl-delay from
+// robots.txt. It returns zero when requests to the host are not throttled.
+func (w *Worker) HostDelay(host string) time.Duration {
+	if w.limiter == nil {
+		return 0
+	}
+	return w.limiter.delay(host)
+}
+
 // Run starts processing requests from the queue
 func (w *Worker) Run(ctx context.Context, q Queue) error {
 	g, ctx := errgroup.WithContext(ctx)
@@ -131,42 +292,134 @@ func skipRedirects(req *http.Request, via []*http.Request) error {
 	return http.ErrUseLastResponse
 }
 
-func fetch(ctx context.Context, c *http.Client, req *Request) (*Response, error) {
+// fetchConfig has the settings from the options used by fetch
+type fetchConfig struct {
+	parsers     map[string]ParseFunc
+	maxBodySize int64
+	keepBody    bool
+	userAgent   string
+}
+
+// defaultFetchConfig is used when no options change how URLs are fetched
+var defaultFetchConfig = &fetchConfig{parsers: defaultParsers}
+
+// fetch requests the URL, parsing the body with the parser for its media type
+func fetch(ctx context.Context, c *http.Client, req *Request, cfg *fetchConfig) (*Response, error) {
 	uri := req.URL.String()
 	httpReq, err := http.NewRequest(http.MethodGet, uri, nil)
 	if err != nil {
 		return nil, err
 	}
-	httpReq = httpReq.WithContext(ctx)
+	if cfg.userAgent != "" {
+		httpReq.Header.Set("User-Agent", cfg.userAgent)
+	}
+	trace := newTimingTrace()
+	httpReq = httpReq.WithContext(httptrace.WithClientTrace(ctx, trace.clientTrace()))
 
 	httpRes, err := c.Do(httpReq)
 	if err != nil {
-		return nil, err
+		return nil, newNetworkError(req, err)
 	}
 	defer httpRes.Body.Close()
-	res := Response{
-		request: req,
+	res, err := newResponse(req, httpRes)
+	if err != nil || res.RedirectTo != "" {
+		if res != nil {
+			res.Timing = trace.done()
+		}
+		return res, err
+	}
+	var (
+		body    io.Reader = httpRes.Body
+		limited *io.LimitedReader
+		kept    *bodyWriter
+	)
+	if cfg.maxBodySize > 0 {
+		limited = &io.LimitedReader{R: body, N: cfg.maxBodySize}
+		body = limited
+	}
+	if cfg.keepBody {
+		kept = &bodyWriter{}
+		body = io.TeeReader(body, kept)
 	}
-	switch httpRes.StatusCode {
-	case http.StatusOK:
-	case http.StatusMovedPermanently, http.StatusFound:
-		res.URL = httpRes.Request.URL.String()
+	br := bufio.NewReaderSize(body, sniffLen)
+	if parse := cfg.parsers[mediaType(res.ContentType, br)]; parse != nil {
+		counter := &countingReader{r: br}
+		err = parse(httpRes.Request.URL, counter, res)
+		if res.ContentLength < 0 && err == nil {
+			res.ContentLength = counter.n
+		}
+	}
+	if kept != nil {
+		// keep what the parser did not read
+		if _, err := io.Copy(ioutil.Discard, br); err != nil {
+			kept.discard()
+			return nil, newNetworkError(req, err)
+		}
+		if res.Body, err = kept.body(); err != nil {
+			return nil, err
+		}
+	}
+	if limited != nil {
+		res.Truncated = httpRes.ContentLength > cfg.maxBodySize
+		if !res.Truncated && limited.N == 0 {
+			var b [1]byte
+			n, _ := httpRes.Body.Read(b[:])
+			res.Truncated = n > 0
+		}
+	}
+	readRobotsHeader(res, httpRes.Header)
+	res.Timing = trace.done()
+	return res, nil
+}
+
+// newResponse builds the response for the status and headers of the HTTP
+// response, returning an *HTTPError for unexpected status codes
+func newResponse(req *Request, httpRes *http.Response) (*Response, error) {
+	res := &Response{
+		URL:           httpRes.Request.URL.String(),
+		StatusCode:    httpRes.StatusCode,
+		Header:        httpRes.Header,
+		ContentType:   httpRes.Header.Get("Content-Type"),
+		ContentLength: httpRes.ContentLength,
+		RedirectChain: req.chain,
+		Sitemap:       req.sitemap,
+		Attempts:      req.attempts + 1,
+		Asset:         req.IsAsset(),
+		request:       req,
+	}
+	switch {
+	case httpRes.StatusCode == http.StatusOK:
+	case isRedirect(httpRes.StatusCode):
 		loc, err := url.Parse(httpRes.Header.Get("Location"))
 		if err != nil {
 			return nil, err
 		}
 		res.RedirectTo = httpRes.Request.URL.ResolveReference(loc).String()
-		return &res, nil
 	default:
-		return nil, fmt.Errorf("%s for %s", httpRes.Status, uri)
-	}
-	if strings.Contains(httpRes.Header.Get("Content-Type"), "text/html") {
-		err = ReadResponse(httpRes.Request.URL, httpRes.Body, &res)
+		return res, &HTTPError{
+			StatusCode: httpRes.StatusCode,
+			Status:     httpRes.Status,
+			URL:        req.URL.String(),
+			Header:     httpRes.Header,
+			Request:    req,
+		}
 	}
-	return &res, nil
+	return res, nil
+}
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
 }
 
-func nextRequest(res *Response, href string) (*Request, error) {
+func nextRequest(res *Response, href string, redirect bool) (*Request, error) {
 	if href == "" {
 		return nil, ErrSkipURL
 	}
@@ -174,11 +427,14 @@ func nextRequest(res *Response, href string) (*Request, error) {
 	if err != nil {
 		return nil, err
 	}
-	if res.RedirectTo == "" {
+	if !redirect {
 		req.depth = res.request.depth + 1
 		req.redirects = 0
 	} else {
+		req.depth = res.request.depth
 		req.redirects = res.request.redirects + 1
+		req.chain = append(append([]Redirect(nil), res.RedirectChain...), redirectHop(res))
+		req.page = res.request.page
 	}
 	return req, nil
 }
@@ -106,7 +106,7 @@ func TestFetch(t *testing.T) {
 			req, err := NewRequest(s.URL + test.path)
 			require.NoError(t, err)
 
-			res, err := fetch(context.Background(), c, req)
+			res, err := fetch(context.Background(), c, req, defaultFetchConfig)
 			require.NoError(t, err)
 
 			require.Equal(t, test.expectedURL, res.URL)
@@ -114,3 +114,33 @@ func TestFetch(t *testing.T) {
 		})
 	}
 }
+
+func TestFetchResponseDetails(t *testing.T) {
+	r := require.New(t)
+
+	s := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer s.Close()
+
+	req, err := NewRequest(s.URL + "/depth-one.html")
+	r.NoError(err)
+
+	res, err := fetch(context.Background(), &http.Client{CheckRedirect: skipRedirects}, req, defaultFetchConfig)
+	r.NoError(err)
+
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.Equal("text/html; charset=utf-8", res.ContentType)
+	r.Equal(res.ContentType, res.Header.Get("Content-Type"))
+	r.True(res.ContentLength > 0)
+	r.NotNil(res.Timing)
+	r.True(res.Timing.TTFB > 0)
+	r.True(res.Timing.Total >= res.Timing.TTFB)
+
+	// redirects keep the details of the redirect response
+	req, err = NewRequest(s.URL + "/index.html")
+	r.NoError(err)
+
+	res, err = fetch(context.Background(), &http.Client{CheckRedirect: skipRedirects}, req, defaultFetchConfig)
+	r.NoError(err)
+	r.Equal(http.StatusMovedPermanently, res.StatusCode)
+	r.Equal("./", res.Header.Get("Location"))
+}